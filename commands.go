@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gofit/config"
+	"github.com/gofit/models"
+	"github.com/gofit/notify"
+	"github.com/gofit/reports"
+)
+
+// selectUsers returns the requested user, or every linked user when none was given
+func selectUsers(cfg *config.Config, user string) ([]string, error) {
+	if user != "" {
+		if !models.UserExists(cfg.DataDir, user) {
+			return nil, fmt.Errorf("unknown user %q", user)
+		}
+		return []string{user}, nil
+	}
+
+	users, err := models.ListUsers(cfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("no users found in %s, run 'gofit auth login --user NAME' first", cfg.DataDir)
+	}
+	return users, nil
+}
+
+// singleUser returns the requested user, or the only linked user when none was given
+func singleUser(cfg *config.Config, user string) (string, error) {
+	users, err := selectUsers(cfg, user)
+	if err != nil {
+		return "", err
+	}
+	if len(users) > 1 {
+		return "", fmt.Errorf("several users exist, choose one with --user")
+	}
+	return users[0], nil
+}
+
+func runSync(args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	days := fs.Int("days", 0, "only download the last days, 0 downloads everything since the account was created")
+	user := fs.String("user", "", "only sync this user")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *days < 0 {
+		return fmt.Errorf("--days must not be negative")
+	}
+
+	users, err := selectUsers(cfg, *user)
+	if err != nil {
+		return err
+	}
+
+	var failed []error
+	for _, name := range users {
+		dataDir := models.UserDataDir(cfg.DataDir, name)
+		account_info, err := models.LoadClientInfo(dataDir)
+		if err == nil {
+			err = models.SyncDataStore(account_info.ClientID, account_info.ClientSecret, dataDir, *days)
+		}
+		if err != nil {
+			slog.Error("Sync failed", "user", name, "err", err)
+			failed = append(failed, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		slog.Info("Synced", "user", name, "days", *days)
+	}
+	return errors.Join(failed...)
+}
+
+func runAuth(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: gofit auth login|logout|status [flags]")
+	}
+
+	switch args[0] {
+	case "login":
+		return runAuthLogin(args[1:])
+	case "logout":
+		return runAuthLogout(args[1:])
+	case "status":
+		return runAuthStatus(args[1:])
+	}
+	return fmt.Errorf("unknown auth command %q", args[0])
+}
+
+func runLogin(args []string) error {
+	if len(args) == 0 || args[0] != "create" {
+		return fmt.Errorf("usage: gofit login create --username NAME")
+	}
+	fs := flag.NewFlagSet("login create", flag.ContinueOnError)
+	username := fs.String("username", "", "name of the dashboard login (required)")
+	cfg, err := loadConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	// The password is read from stdin so it stays out of the shell history
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	if err := models.CreateLogin(cfg.DataDir, *username, password); err != nil {
+		return err
+	}
+	fmt.Printf("Created dashboard login %s\n", *username)
+	return nil
+}
+
+func runAuthLogin(args []string) error {
+	fs := flag.NewFlagSet("auth login", flag.ContinueOnError)
+	user := fs.String("user", "", "name of the account to authorize (required)")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if !models.ValidUserName(*user) {
+		return fmt.Errorf("--user must be a valid account name")
+	}
+
+	dataDir := models.UserDataDir(cfg.DataDir, *user)
+	account_info, err := models.LoadClientInfo(dataDir)
+	// Credentials given on the command line replace the stored ones
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		explicit = explicit || f.Name == "client-id" || f.Name == "client-secret"
+	})
+	if explicit {
+		if cfg.OAuth.ClientID == "" || cfg.OAuth.ClientSecret == "" {
+			return fmt.Errorf("pass both --client-id and --client-secret")
+		}
+		account_info.ClientID, account_info.ClientSecret, err = cfg.OAuth.ClientID, cfg.OAuth.ClientSecret, nil
+	}
+	if os.IsNotExist(err) {
+		return fmt.Errorf("no client credentials for %s, pass --client-id and --client-secret", *user)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep the credentials with the user so later syncs work without the flags
+	err = models.SaveClientInfo(dataDir, account_info)
+	if err != nil {
+		return err
+	}
+
+	err = models.Authorize(account_info.ClientID, account_info.ClientSecret, dataDir)
+	if err != nil {
+		return fmt.Errorf("authorization failed: %w", err)
+	}
+	fmt.Printf("Authorized %s\n", *user)
+	return nil
+}
+
+func runAuthLogout(args []string) error {
+	fs := flag.NewFlagSet("auth logout", flag.ContinueOnError)
+	user := fs.String("user", "", "account to disconnect")
+	purge := fs.Bool("purge", false, "also delete all downloaded health data, goals, records, notifications and reports")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	name, err := singleUser(cfg, *user)
+	if err != nil {
+		return err
+	}
+	dataDir := models.UserDataDir(cfg.DataDir, name)
+
+	// Missing client info is not fatal, the local tokens can still be removed
+	account_info, err := models.LoadClientInfo(dataDir)
+	if err != nil {
+		slog.Warn("Failed to load account info", "err", err)
+	}
+
+	result, err := models.DisconnectAccount(account_info.ClientID, account_info.ClientSecret, dataDir, *purge)
+	if err != nil {
+		return err
+	}
+	switch result.Revocation {
+	case models.Revoked:
+		fmt.Printf("Revoked access of %s at Fitbit\n", name)
+	case models.RevokeNoToken:
+		fmt.Printf("No token stored for %s, nothing was revoked at Fitbit\n", name)
+	case models.RevokeSkipped:
+		fmt.Printf("Client credentials of %s are missing, the token was not revoked at Fitbit\n", name)
+	}
+	fmt.Printf("Disconnected %s (removed: %v)\n", name, result.Removed)
+	return nil
+}
+
+func runAuthStatus(args []string) error {
+	fs := flag.NewFlagSet("auth status", flag.ContinueOnError)
+	user := fs.String("user", "", "only show this user")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	users, err := selectUsers(cfg, *user)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tAUTHORIZED\tFITBIT ID\tTOKEN EXPIRES")
+	for _, name := range users {
+		token, err := models.LoadToken(models.UserDataDir(cfg.DataDir, name))
+		if err != nil {
+			fmt.Fprintf(tw, "%s\tno\t-\t-\n", name)
+			continue
+		}
+		fmt.Fprintf(tw, "%s\tyes\t%s\t%s\n", name, token.UserID, formatExpiry(token.ExpiresAt))
+	}
+	return tw.Flush()
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	user := fs.String("user", "", "account to export")
+	format := fs.String("format", "csv", "output format, csv or json")
+	output := fs.String("output", "", "write to this file instead of stdout")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	name, err := singleUser(cfg, *user)
+	if err != nil {
+		return err
+	}
+	cache, err := models.LoadCacheData(models.UserDataDir(cfg.DataDir, name))
+	if err != nil {
+		return fmt.Errorf("no data to export for %s, run 'gofit sync' first: %w", name, err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	rows := cache.History.ExportRows()
+	if *format == "json" {
+		return models.WriteJSON(w, rows)
+	}
+	return models.WriteCSV(w, rows)
+}
+
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	user := fs.String("user", "", "only report on this user")
+	period := fs.String("period", "weekly", "period covered, weekly or monthly")
+	email := fs.Bool("email", false, "also email the report to report.email_to")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+	p, ok := reports.ParsePeriod(*period)
+	if !ok {
+		return fmt.Errorf("unknown period %q", *period)
+	}
+	if *email && cfg.Report.EmailTo == "" {
+		return fmt.Errorf("--email needs report.email_to and the smtp settings")
+	}
+
+	users, err := selectUsers(cfg, *user)
+	if err != nil {
+		return err
+	}
+
+	r := p.Range(models.Today())
+	var failed []error
+	for _, name := range users {
+		dataDir := models.UserDataDir(cfg.DataDir, name)
+		path, err := reports.Write(dataDir, p, r)
+		if err == nil && *email {
+			err = reports.Email(dataDir, p, r)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		fmt.Println(path)
+	}
+	return errors.Join(failed...)
+}
+
+func runNotify(args []string) error {
+	if len(args) == 0 || args[0] != "test" {
+		return fmt.Errorf("usage: gofit notify test [flags]")
+	}
+	fs := flag.NewFlagSet("notify test", flag.ContinueOnError)
+	user := fs.String("user", "", "account the test notification is sent for")
+	cfg, err := loadConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	name, err := singleUser(cfg, *user)
+	if err != nil {
+		return err
+	}
+
+	n := models.Notification{
+		Title:   "Test notification",
+		Message: "Notifications of gofit reach this channel.",
+		At:      time.Now(),
+	}
+	failed := notify.Send(models.UserDataDir(cfg.DataDir, name), n)
+	for _, channel := range notify.Channels() {
+		if err, ok := failed[channel]; ok {
+			fmt.Printf("%-8s failed: %v\n", channel, err)
+		} else {
+			fmt.Printf("%-8s sent\n", channel)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d channels failed", len(failed), len(notify.Channels()))
+	}
+	return nil
+}
+
+func runStatus(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	user := fs.String("user", "", "only show this user")
+	cfg, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	users, err := selectUsers(cfg, *user)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USER\tLAST SYNC\tTOKEN EXPIRES\tSTEPS\tCALORIES\tELEVATION\tHEART RATE")
+	for _, name := range users {
+		dataDir := models.UserDataDir(cfg.DataDir, name)
+
+		expiry := "not authorized"
+		if token, err := models.LoadToken(dataDir); err == nil {
+			expiry = formatExpiry(token.ExpiresAt)
+		}
+
+		cache, err := models.LoadCacheData(dataDir)
+		if err != nil {
+			fmt.Fprintf(tw, "%s\tnever\t%s\t-\t-\t-\t-\n", name, expiry)
+			continue
+		}
+		fetched := cache.History.Fetched
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name,
+			time.Unix(cache.Timestamp, 0).Format(time.DateTime), expiry,
+			fetchedDays(fetched, "steps"), fetchedDays(fetched, "calories"),
+			fetchedDays(fetched, "elevation"), fetchedDays(fetched, "heart_rate"))
+	}
+	return tw.Flush()
+}
+
+// fetchedDays describes the downloaded dates of metric for the status table
+func fetchedDays(fetched map[string]models.DateRange, metric string) string {
+	r, ok := fetched[metric]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%d days since %s", r.Days(), r.From.Format(time.DateOnly))
+}
+
+func formatExpiry(expiresAt time.Time) string {
+	if time.Now().After(expiresAt) {
+		return "expired " + expiresAt.Format(time.DateTime)
+	}
+	return expiresAt.Format(time.DateTime)
+}
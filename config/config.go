@@ -0,0 +1,264 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net/mail"
+	"net/url"
+	"time"
+)
+
+// Config is the effective configuration of gofit
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	DataDir   string          `yaml:"data_dir" flag:"data-dir" desc:"directory holding tokens, caches and user data"`
+	OAuth     OAuthConfig     `yaml:"oauth"`
+	Cache     CacheConfig     `yaml:"cache"`
+	Dashboard DashboardConfig `yaml:"dashboard"`
+	Report    ReportConfig    `yaml:"report"`
+	SMTP      SMTPConfig      `yaml:"smtp"`
+	Notify    NotifyConfig    `yaml:"notify"`
+	Log       LogConfig       `yaml:"log"`
+}
+
+// ServerConfig configures the dashboard HTTP server
+type ServerConfig struct {
+	Host            string   `yaml:"host" flag:"host" desc:"interface the dashboard listens on"`
+	Port            int      `yaml:"port" flag:"port" desc:"port the dashboard listens on"`
+	ReadTimeout     Duration `yaml:"read_timeout" flag:"read-timeout" desc:"maximum time to read a request"`
+	WriteTimeout    Duration `yaml:"write_timeout" flag:"write-timeout" desc:"maximum time to write a response, syncs run in the background and their event stream is exempt"`
+	IdleTimeout     Duration `yaml:"idle_timeout" flag:"idle-timeout" desc:"how long idle keep-alive connections stay open"`
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" flag:"shutdown-timeout" desc:"how long shutdown waits for requests and syncs to finish"`
+}
+
+// OAuthConfig configures the Fitbit authorization flow
+type OAuthConfig struct {
+	RedirectURI  string `yaml:"redirect_uri" flag:"redirect-uri" desc:"OAuth redirect URI registered with Fitbit, without the port"`
+	RedirectPort int    `yaml:"redirect_port" flag:"redirect-port" desc:"port of the OAuth callback listener"`
+	// ClientID and ClientSecret are used for accounts that have no account_info.json of their own
+	ClientID     string `yaml:"client_id" flag:"client-id" desc:"default Fitbit client ID"`
+	ClientSecret string `yaml:"client_secret" flag:"client-secret" desc:"default Fitbit client secret" secret:"true"`
+}
+
+// CacheConfig configures how long downloaded data is reused
+type CacheConfig struct {
+	MaxAge Duration `yaml:"max_age" flag:"cache-max-age" desc:"how long cached Fitbit data is used before downloading again"`
+}
+
+// DashboardConfig configures the dashboard defaults
+type DashboardConfig struct {
+	DefaultDays int `yaml:"default_days" flag:"default-days" desc:"number of days shown when the dashboard opens"`
+	// Daily charts are overlaid with two rolling averages and optionally a smoothed trend line
+	ShortAverage int    `yaml:"short_average" flag:"short-average" desc:"days of the short rolling average on daily charts, 0 to disable"`
+	LongAverage  int    `yaml:"long_average" flag:"long-average" desc:"days of the long rolling average on daily charts, 0 to disable"`
+	Smoother     string `yaml:"smoother" flag:"smoother" desc:"trend line on daily charts: none, ema or loess"`
+	// Days straying from the personal baseline by this many standard deviations are flagged
+	AnomalyZScore float64 `yaml:"anomaly_z_score" flag:"anomaly-z-score" desc:"z-score from which a day is flagged as an anomaly, 0 to disable"`
+}
+
+// ReportConfig configures the weekly and monthly reports written after syncs
+type ReportConfig struct {
+	Weekly  bool   `yaml:"weekly" flag:"report-weekly" desc:"write a report of the past week after the first sync of a week"`
+	Monthly bool   `yaml:"monthly" flag:"report-monthly" desc:"write a report of the past month after the first sync of a month"`
+	EmailTo string `yaml:"email_to" flag:"report-email-to" desc:"address reports are emailed to, empty to only save them"`
+}
+
+// SMTPConfig configures the mail server emails are sent through
+type SMTPConfig struct {
+	Host     string `yaml:"host" flag:"smtp-host" desc:"mail server, empty to disable email"`
+	Port     int    `yaml:"port" flag:"smtp-port" desc:"port of the mail server"`
+	Username string `yaml:"username" flag:"smtp-username" desc:"account at the mail server, empty to send without authentication"`
+	Password string `yaml:"password" flag:"smtp-password" desc:"password of the account at the mail server" secret:"true"`
+	From     string `yaml:"from" flag:"smtp-from" desc:"sender address of emails"`
+}
+
+// NotifyConfig configures where the notifications of the rules of each user are sent,
+// besides the inbox of the dashboard
+type NotifyConfig struct {
+	WebhookURL string `yaml:"webhook_url" flag:"notify-webhook-url" desc:"URL notifications are posted to as JSON, empty to disable" secret:"true"`
+	PushURL    string `yaml:"push_url" flag:"notify-push-url" desc:"ntfy topic or Gotify message URL notifications are pushed to, empty to disable" secret:"true"`
+	PushFormat string `yaml:"push_format" flag:"notify-push-format" desc:"API of the push URL, ntfy or gotify"`
+	PushToken  string `yaml:"push_token" flag:"notify-push-token" desc:"access token of the ntfy topic or Gotify application" secret:"true"`
+	EmailTo    string `yaml:"email_to" flag:"notify-email-to" desc:"address notifications are emailed to through the smtp server, empty to disable"`
+}
+
+// LogConfig configures the application log
+type LogConfig struct {
+	Level      string   `yaml:"level" flag:"log-level" desc:"minimum level logged: debug, info, warn or error"`
+	Format     string   `yaml:"format" flag:"log-format" desc:"log format, text or json"`
+	File       string   `yaml:"file" flag:"log-file" desc:"log file of the dashboard, empty to log to the console only"`
+	MaxSizeMB  int      `yaml:"max_size_mb" flag:"log-max-size" desc:"size in MB at which the log file is rotated, 0 to disable"`
+	MaxAge     Duration `yaml:"max_age" flag:"log-max-age" desc:"age at which the log file is rotated, 0 to disable"`
+	MaxBackups int      `yaml:"max_backups" flag:"log-max-backups" desc:"number of rotated log files kept"`
+}
+
+// Duration is a time.Duration that reads and writes as "2h30m" in files, env vars and flags
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+// maxDefaultDays is the largest window the dashboard can open with
+const maxDefaultDays = 366
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Host:            "0.0.0.0",
+			Port:            8081,
+			ReadTimeout:     Duration{15 * time.Second},
+			WriteTimeout:    Duration{2 * time.Minute},
+			IdleTimeout:     Duration{2 * time.Minute},
+			ShutdownTimeout: Duration{30 * time.Second},
+		},
+		DataDir: "fitbit_data",
+		OAuth: OAuthConfig{
+			RedirectURI:  "http://fitbit-pi.local",
+			RedirectPort: 8080,
+		},
+		Cache: CacheConfig{
+			MaxAge: Duration{2 * time.Hour},
+		},
+		Dashboard: DashboardConfig{
+			DefaultDays:   14,
+			ShortAverage:  7,
+			LongAverage:   30,
+			Smoother:      "none",
+			AnomalyZScore: 2,
+		},
+		SMTP: SMTPConfig{
+			Port: 587,
+		},
+		Notify: NotifyConfig{
+			PushFormat: "ntfy",
+		},
+		Log: LogConfig{
+			Level:      "info",
+			Format:     "text",
+			File:       "logs/app.log",
+			MaxSizeMB:  10,
+			MaxAge:     Duration{7 * 24 * time.Hour},
+			MaxBackups: 5,
+		},
+	}
+}
+
+// Validate reports the first invalid setting
+func (c *Config) Validate() error {
+	if c.Server.Host == "" {
+		return fmt.Errorf("server.host must not be empty")
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		return fmt.Errorf("server.port %d is out of range", c.Server.Port)
+	}
+	if c.Server.ReadTimeout.Duration <= 0 || c.Server.WriteTimeout.Duration <= 0 || c.Server.IdleTimeout.Duration <= 0 {
+		return fmt.Errorf("server timeouts must be positive")
+	}
+	if c.Server.ShutdownTimeout.Duration <= 0 {
+		return fmt.Errorf("server.shutdown_timeout must be positive")
+	}
+	if c.DataDir == "" {
+		return fmt.Errorf("data_dir must not be empty")
+	}
+	u, err := url.Parse(c.OAuth.RedirectURI)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("oauth.redirect_uri %q must be an absolute http(s) URL", c.OAuth.RedirectURI)
+	}
+	if u.Port() != "" {
+		return fmt.Errorf("oauth.redirect_uri must not contain a port, use oauth.redirect_port")
+	}
+	if c.OAuth.RedirectPort < 1 || c.OAuth.RedirectPort > 65535 {
+		return fmt.Errorf("oauth.redirect_port %d is out of range", c.OAuth.RedirectPort)
+	}
+	if c.OAuth.RedirectPort == c.Server.Port {
+		return fmt.Errorf("oauth.redirect_port must differ from server.port")
+	}
+	if (c.OAuth.ClientID == "") != (c.OAuth.ClientSecret == "") {
+		return fmt.Errorf("oauth.client_id and oauth.client_secret must be set together")
+	}
+	if c.Cache.MaxAge.Duration < 0 {
+		return fmt.Errorf("cache.max_age must not be negative")
+	}
+	if c.Dashboard.DefaultDays < 1 || c.Dashboard.DefaultDays > maxDefaultDays {
+		return fmt.Errorf("dashboard.default_days must be between 1 and %d", maxDefaultDays)
+	}
+	if c.Dashboard.ShortAverage < 0 || c.Dashboard.ShortAverage > maxDefaultDays ||
+		c.Dashboard.LongAverage < 0 || c.Dashboard.LongAverage > maxDefaultDays {
+		return fmt.Errorf("dashboard rolling averages must be between 0 and %d days", maxDefaultDays)
+	}
+	// Both would be drawn as the same line under the same name
+	if c.Dashboard.ShortAverage > 0 && c.Dashboard.ShortAverage == c.Dashboard.LongAverage {
+		return fmt.Errorf("dashboard.short_average and dashboard.long_average must differ")
+	}
+	if c.Dashboard.Smoother != "none" && c.Dashboard.Smoother != "ema" && c.Dashboard.Smoother != "loess" {
+		return fmt.Errorf("dashboard.smoother %q must be none, ema or loess", c.Dashboard.Smoother)
+	}
+	if c.Dashboard.AnomalyZScore < 0 {
+		return fmt.Errorf("dashboard.anomaly_z_score must not be negative")
+	}
+	if c.Report.EmailTo != "" {
+		if _, err := mail.ParseAddress(c.Report.EmailTo); err != nil {
+			return fmt.Errorf("report.email_to %q is not an email address", c.Report.EmailTo)
+		}
+		if c.SMTP.Host == "" || c.SMTP.From == "" {
+			return fmt.Errorf("report.email_to needs smtp.host and smtp.from")
+		}
+	}
+	for name, raw := range map[string]string{"notify.webhook_url": c.Notify.WebhookURL, "notify.push_url": c.Notify.PushURL} {
+		if raw == "" {
+			continue
+		}
+		// The URL is left out of the error, it may hold a token
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s must be an absolute http(s) URL", name)
+		}
+	}
+	if c.Notify.PushFormat != "ntfy" && c.Notify.PushFormat != "gotify" {
+		return fmt.Errorf("notify.push_format %q must be ntfy or gotify", c.Notify.PushFormat)
+	}
+	if c.Notify.EmailTo != "" {
+		if _, err := mail.ParseAddress(c.Notify.EmailTo); err != nil {
+			return fmt.Errorf("notify.email_to %q is not an email address", c.Notify.EmailTo)
+		}
+		if c.SMTP.Host == "" || c.SMTP.From == "" {
+			return fmt.Errorf("notify.email_to needs smtp.host and smtp.from")
+		}
+	}
+	if c.SMTP.Port < 1 || c.SMTP.Port > 65535 {
+		return fmt.Errorf("smtp.port %d is out of range", c.SMTP.Port)
+	}
+	if c.SMTP.From != "" {
+		if _, err := mail.ParseAddress(c.SMTP.From); err != nil {
+			return fmt.Errorf("smtp.from %q is not an email address", c.SMTP.From)
+		}
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		return fmt.Errorf("log.level %q must be debug, info, warn or error", c.Log.Level)
+	}
+	if c.Log.Format != "text" && c.Log.Format != "json" {
+		return fmt.Errorf("log.format %q must be text or json", c.Log.Format)
+	}
+	if c.Log.MaxSizeMB < 0 || c.Log.MaxAge.Duration < 0 || c.Log.MaxBackups < 0 {
+		return fmt.Errorf("log rotation settings must not be negative")
+	}
+	return nil
+}
+
+// Addr returns the host:port the dashboard listens on
+func (c *Config) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
+}
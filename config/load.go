@@ -0,0 +1,195 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when no config file is given and it exists
+const DefaultFile = "gofit.yaml"
+
+// envPrefix is prepended to the upper-cased yaml path of every setting
+const envPrefix = "GOFIT_"
+
+// setting is one leaf of the Config struct
+type setting struct {
+	path   string // dotted yaml path, e.g. server.port
+	flag   string
+	desc   string
+	secret bool
+	value  reflect.Value
+}
+
+// envName returns the environment variable overriding the setting
+func (s setting) envName() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.path, ".", "_"))
+}
+
+// settings lists the leaves of cfg in declaration order
+func settings(cfg *Config) []setting {
+	var out []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+			path := prefix + name
+			fv := v.Field(i)
+
+			_, isText := fv.Addr().Interface().(encoding.TextUnmarshaler)
+			if field.Type.Kind() == reflect.Struct && !isText {
+				walk(fv, path+".")
+				continue
+			}
+			out = append(out, setting{
+				path:   path,
+				flag:   field.Tag.Get("flag"),
+				desc:   field.Tag.Get("desc"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  fv,
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return out
+}
+
+// set parses raw into the setting
+func (s setting) set(raw string) error {
+	if u, ok := s.value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		s.value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		s.value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		s.value.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", s.value.Type())
+	}
+	return nil
+}
+
+// Load builds the effective configuration. Later sources win:
+// defaults, then the YAML config file, then GOFIT_* environment variables, then flags.
+// The config flags are added to fs, which may carry command specific flags of its own,
+// and args are parsed with it. Positional arguments are left in fs.Args().
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := Default()
+
+	configFile := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path to a YAML config file (default "+DefaultFile+" if present)")
+
+	// Flags are only recorded while parsing so they can be applied after the file and env vars
+	flagValues := map[string]string{}
+	for _, s := range settings(Default()) {
+		if s.flag == "" {
+			continue
+		}
+		fs.Func(s.flag, fmt.Sprintf("%s (env %s)", s.desc, s.envName()), func(raw string) error {
+			flagValues[s.flag] = raw
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := loadFile(cfg, *configFile); err != nil {
+		return nil, err
+	}
+
+	for _, s := range settings(cfg) {
+		raw, ok := os.LookupEnv(s.envName())
+		if !ok {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", s.envName(), err)
+		}
+	}
+
+	for _, s := range settings(cfg) {
+		raw, ok := flagValues[s.flag]
+		if !ok || s.flag == "" {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			return nil, fmt.Errorf("invalid -%s: %w", s.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile merges a YAML file into cfg. A missing default file is not an error.
+func loadFile(cfg *Config, path string) error {
+	explicit := path != ""
+	if !explicit {
+		path = DefaultFile
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with all secrets masked
+func (c *Config) Redacted() *Config {
+	copied := *c
+	for _, s := range settings(&copied) {
+		if s.secret && !s.value.IsZero() {
+			s.set("REDACTED")
+		}
+	}
+	return &copied
+}
+
+// Print writes the config as YAML
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(c)
+}
@@ -4,7 +4,12 @@ go 1.23.6
 
 require (
 	github.com/a-h/templ v0.3.898
+	github.com/andybalholm/brotli v1.1.0
 	github.com/go-echarts/go-echarts/v2 v2.5.4
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/crypto v0.36.0
 	golang.org/x/text v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/kr/text v0.2.0 // indirect
@@ -2,6 +2,11 @@
 
 DEV=false
 PROD=false
+VENDOR=false
+
+HTMX_VERSION=2.0.4
+HTMX_SHA384=HGfztofotfshcF7+8n44JQL2oJmowVChPTg48S+jvZoztPfvwD79OC/LTtG6dMp+
+ECHARTS_ASSETS=https://go-echarts.github.io/go-echarts-assets/assets
 
 usage() {
     cat <<EOF
@@ -10,6 +15,7 @@ Usage: $0 [OPTIONS]
 Options:
   -d, --dev     Start in development mode
   -p, --prod    Build and run production deployment
+  -v, --vendor  Download htmx and echarts into static/js/vendor so they are embedded in the binary
   -h, --help    Show this help message
 EOF
     exit 0
@@ -25,6 +31,10 @@ while [[ $# -gt 0 ]];do
         PROD=true
         shift
         ;;
+        -v|--vendor)
+        VENDOR=true
+        shift
+        ;;
         -h|--help)
         usage
         ;;
@@ -35,10 +45,31 @@ while [[ $# -gt 0 ]];do
     esac
 done
 
-if [ "$DEV" = false ] && [ "$PROD" = false ] ; then
+if [ "$DEV" = false ] && [ "$PROD" = false ] && [ "$VENDOR" = false ] ; then
     usage
 fi
 
+if [ "$VENDOR" = true ] ; then
+    set -e
+    mkdir -p static/js/vendor/echarts/themes
+
+    echo "Downloading htmx $HTMX_VERSION..."
+    curl -fsSL -o static/js/vendor/htmx.min.js "https://unpkg.com/htmx.org@$HTMX_VERSION/dist/htmx.min.js"
+    actual=$(openssl dgst -sha384 -binary static/js/vendor/htmx.min.js | openssl base64 -A)
+    if [ "$actual" != "$HTMX_SHA384" ] ; then
+        echo "htmx checksum mismatch: got $actual"
+        rm static/js/vendor/htmx.min.js
+        exit 1
+    fi
+
+    echo "Downloading echarts..."
+    curl -fsSL -o static/js/vendor/echarts/echarts.min.js "$ECHARTS_ASSETS/echarts.min.js"
+    curl -fsSL -o static/js/vendor/echarts/themes/macarons.js "$ECHARTS_ASSETS/themes/macarons.js"
+
+    echo "Vendored scripts saved in static/js/vendor, commit them and rebuild to embed them"
+    set +e
+fi
+
 if [ "$DEV" = true ] ; then
     echo "Starting in development mode..."
     templ generate --watch &
@@ -49,18 +80,25 @@ if [ "$PROD" = true ] ; then
     set -e
 
     # Create deploy directory
-    mkdir -p deploy/static
-    mkdir -p deploy/templates
+    mkdir -p deploy
+
+    # Without the vendored scripts the pages need internet access for the CDNs
+    for script in static/js/vendor/htmx.min.js static/js/vendor/echarts/echarts.min.js static/js/vendor/echarts/themes/macarons.js ; do
+        if [ ! -f "$script" ] ; then
+            echo "Warning: $script is missing, pages load it from its CDN. Run $0 --vendor and commit the files first"
+        fi
+    done
 
-    # Build binary
+    # Build binary, templates and static assets are compiled in
+    templ generate
     go build -o deploy/fitbit-server
 
-    # Copy assets
-    cp -r static/* deploy/static/
-    cp -r templates/* deploy/templates/
-    cp .env deploy/
+    # The .env file is optional
+    if [ -f .env ] ; then
+        cp .env deploy/
+    fi
 
     echo "Deployment package created in ./deploy"
-    ./deploy/fitbit-server
+    ./deploy/fitbit-server serve
     exit 0
 fi
@@ -0,0 +1,102 @@
+// Package logging sets up the structured application log shared by the
+// dashboard and the command line.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gofit/config"
+)
+
+// Level is the minimum level logged. It can be changed while the server runs.
+var Level = new(slog.LevelVar)
+
+// Setup installs the default slog logger, which also receives everything written
+// with the standard log package. Records go to console, when it is not nil, and to
+// the rotating file of cfg, when one is set. The returned closer closes that file.
+func Setup(cfg config.LogConfig, console io.Writer) (io.Closer, error) {
+	err := Level.UnmarshalText([]byte(cfg.Level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+
+	var writers []io.Writer
+	if console != nil {
+		writers = append(writers, console)
+	}
+	var closer io.Closer = io.NopCloser(nil)
+	if cfg.File != "" {
+		file, err := newRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxAge.Duration, cfg.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, file)
+		closer = file
+	}
+
+	opts := &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       Level,
+		ReplaceAttr: replaceAttr,
+	}
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(io.MultiWriter(writers...), opts)
+	} else {
+		handler = slog.NewTextHandler(io.MultiWriter(writers...), opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return closer, nil
+}
+
+// replaceAttr shortens source locations to file:line and redacts secrets
+func replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.SourceKey && len(groups) == 0 {
+		if src, ok := a.Value.Any().(*slog.Source); ok {
+			return slog.String(slog.SourceKey, filepath.Base(src.File)+":"+strconv.Itoa(src.Line))
+		}
+	}
+	return redactAttr(a)
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context whose log records carry the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID of ctx, or "" outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID of the context to every record logged with it
+// and keeps the latest errors for RecentErrors
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelError {
+		remember(ctx, r)
+	}
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,63 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentErrorsSize is how many error records RecentErrors keeps
+const recentErrorsSize = 50
+
+// ErrorEntry is an error record kept for the diagnostics page
+type ErrorEntry struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Attrs   string    `json:"attrs"`
+}
+
+var (
+	recentMu   sync.Mutex
+	recent     [recentErrorsSize]ErrorEntry
+	recentNext int
+	recentLen  int
+)
+
+// remember adds an error record to the ring buffer, redacted like the log itself
+func remember(ctx context.Context, r slog.Record) {
+	var attrs []string
+	if id := RequestID(ctx); id != "" {
+		attrs = append(attrs, "request_id="+id)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		a = redactAttr(a)
+		attrs = append(attrs, a.Key+"="+a.Value.String())
+		return true
+	})
+
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	recent[recentNext] = ErrorEntry{
+		Time:    r.Time,
+		Message: Redact(r.Message),
+		Attrs:   strings.Join(attrs, " "),
+	}
+	recentNext = (recentNext + 1) % recentErrorsSize
+	if recentLen < recentErrorsSize {
+		recentLen++
+	}
+}
+
+// RecentErrors returns the last error records, newest first
+func RecentErrors() []ErrorEntry {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+
+	out := make([]ErrorEntry, 0, recentLen)
+	for i := 1; i <= recentLen; i++ {
+		out = append(out, recent[(recentNext-i+recentErrorsSize)%recentErrorsSize])
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// secretKeyParts mark attribute keys whose values are never logged
+var secretKeyParts = []string{"token", "secret", "password", "authorization", "cookie"}
+
+// secretPatterns find credentials inside logged messages, request and response bodies.
+// The first group of each pattern is kept, the rest of the match is replaced.
+var secretPatterns = []*regexp.Regexp{
+	// JSON bodies, e.g. Fitbit token responses
+	regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|client_secret|password|token)"\s*:\s*")[^"]*`),
+	// Query strings and form bodies, e.g. the OAuth callback
+	regexp.MustCompile(`(?i)\b((?:access_token|refresh_token|client_secret|fitbit_secret|password|csrf_token|token|code)=)[^&\s"]+`),
+	// Authorization headers
+	regexp.MustCompile(`(?i)\b((?:Bearer|Basic)\s+)[A-Za-z0-9._~+/=-]+`),
+}
+
+// secretKey reports whether an attribute key names a credential
+func secretKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+	return key == "code"
+}
+
+// Redact replaces credentials found in s
+func Redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
+
+// redactAttr hides secret attributes and credentials inside string and error values
+func redactAttr(a slog.Attr) slog.Attr {
+	if a.Key != slog.MessageKey && secretKey(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
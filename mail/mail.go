@@ -0,0 +1,181 @@
+// Package mail sends the emails of gofit, such as reports, through the
+// configured SMTP server.
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/gofit/config"
+)
+
+// Enabled reports whether a mail server is configured
+func Enabled(cfg config.SMTPConfig) bool {
+	return cfg.Host != "" && cfg.From != ""
+}
+
+// Image is a PNG shown inside an email, which its HTML refers to as cid:ID
+type Image struct {
+	ID  string
+	PNG []byte
+}
+
+// Send delivers an HTML email to the address to, with the images its HTML shows. The
+// server is asked for STARTTLS when it offers it, and the account of cfg is only used
+// when one is set.
+func Send(cfg config.SMTPConfig, to, subject, html string, images ...Image) error {
+	if !Enabled(cfg) {
+		return fmt.Errorf("no mail server configured")
+	}
+	// The addresses may carry a display name, e.g. "Gofit <gofit@example.com>", which
+	// only belongs in the headers
+	from, err := netmail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender address %q: %w", cfg.From, err)
+	}
+	rcpt, err := netmail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address %q: %w", to, err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", rcpt)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	if err := writeBody(&msg, html, images); err != nil {
+		return fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	if err := deliver(cfg, from.Address, rcpt.Address, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", to, err)
+	}
+	return nil
+}
+
+// writeBody writes the Content-Type header and the body of an email, the HTML alone
+// or together with its images as multipart/related
+func writeBody(msg *bytes.Buffer, html string, images []Image) error {
+	htmlHeader := textproto.MIMEHeader{
+		"Content-Type": {"text/html; charset=utf-8"},
+		// SMTP limits the length of lines, which HTML does not
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	}
+	if len(images) == 0 {
+		for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+			fmt.Fprintf(msg, "%s: %s\r\n", key, htmlHeader.Get(key))
+		}
+		msg.WriteString("\r\n")
+		return writeQuoted(msg, html)
+	}
+
+	parts := multipart.NewWriter(msg)
+	fmt.Fprintf(msg, "Content-Type: multipart/related; boundary=%s\r\n\r\n", parts.Boundary())
+	w, err := parts.CreatePart(htmlHeader)
+	if err != nil {
+		return err
+	}
+	if err := writeQuoted(w, html); err != nil {
+		return err
+	}
+	for _, img := range images {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-ID":                {"<" + img.ID + ">"},
+			"Content-Disposition":       {`inline; filename="` + img.ID + `.png"`},
+		})
+		if err != nil {
+			return err
+		}
+		if err := writeBase64(w, img.PNG); err != nil {
+			return err
+		}
+	}
+	return parts.Close()
+}
+
+func writeQuoted(w io.Writer, text string) error {
+	body := quotedprintable.NewWriter(w)
+	if _, err := body.Write([]byte(text)); err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+// writeBase64 writes data in lines of 76 characters
+func writeBase64(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+// timeout bounds the whole SMTP conversation. Emails are sent after syncs, which a
+// stalled server must not hold up.
+const timeout = 30 * time.Second
+
+// deliver hands msg to the server of cfg like smtp.SendMail, within timeout. from and
+// to are bare addresses, as MAIL FROM and RCPT TO take them.
+func deliver(cfg config.SMTPConfig, from, to string, msg []byte) error {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+			return err
+		}
+	}
+	if ok, _ := c.Extension("AUTH"); ok && cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
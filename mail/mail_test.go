@@ -0,0 +1,136 @@
+package mail_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/gofit/config"
+	gomail "github.com/gofit/mail"
+	"github.com/gofit/mail/mailtest"
+)
+
+// receive sends an email through a test server and returns it parsed
+func receive(t *testing.T, subject, html string, images ...gomail.Image) *mail.Message {
+	t.Helper()
+	server := mailtest.NewServer(t)
+	if err := gomail.Send(server.Config("gofit@example.com"), "me@example.com", subject, html, images...); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d emails, want 1", len(messages))
+	}
+	if messages[0].From != "gofit@example.com" || len(messages[0].To) != 1 || messages[0].To[0] != "me@example.com" {
+		t.Errorf("envelope from %q to %q", messages[0].From, messages[0].To)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].Data))
+	if err != nil {
+		t.Fatalf("failed to parse email: %v", err)
+	}
+	return msg
+}
+
+func TestSendHTML(t *testing.T) {
+	// Longer than the 998 characters SMTP allows on a line
+	html := "<p>" + strings.Repeat("ünïcode ", 200) + "</p>"
+	msg := receive(t, "Weekly report", html)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Weekly report" {
+		t.Errorf("subject %q (%v), want %q", subject, err, "Weekly report")
+	}
+	if got := msg.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Errorf("content type %q", got)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(msg.Body))
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	// SMTP ends the data with a line break
+	if got := strings.TrimSuffix(string(body), "\r\n"); got != html {
+		t.Errorf("body %q, want %q", got, html)
+	}
+}
+
+func TestSendImages(t *testing.T) {
+	png := bytes.Repeat([]byte{0x89, 'P', 'N', 'G', 0, 1, 2, 3}, 50)
+	msg := receive(t, "Monthly report", `<img src="cid:chart-1">`, gomail.Image{ID: "chart-1", PNG: png})
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/related" {
+		t.Fatalf("content type %q (%v), want multipart/related", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+
+	// multipart decodes quoted-printable parts itself
+	html, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("no HTML part: %v", err)
+	}
+	if body, _ := io.ReadAll(html); string(body) != `<img src="cid:chart-1">` {
+		t.Errorf("HTML part %q", body)
+	}
+
+	image, err := parts.NextPart()
+	if err != nil {
+		t.Fatalf("no image part: %v", err)
+	}
+	if got := image.Header.Get("Content-ID"); got != "<chart-1>" {
+		t.Errorf("Content-ID %q, want <chart-1>", got)
+	}
+	if got := image.Header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("image content type %q", got)
+	}
+	encoded, _ := io.ReadAll(image)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		if len(line) > 76 {
+			t.Fatalf("base64 line of %d characters", len(line))
+		}
+	}
+	decoded, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(encoded)))
+	if err != nil || !bytes.Equal(decoded, png) {
+		t.Errorf("image does not round trip (%v)", err)
+	}
+
+	if _, err := parts.NextPart(); err != io.EOF {
+		t.Errorf("more parts than the HTML and the image: %v", err)
+	}
+}
+
+func TestSendDisplayNames(t *testing.T) {
+	server := mailtest.NewServer(t)
+	cfg := server.Config("Gofit <gofit@example.com>")
+	if err := gomail.Send(cfg, "Me <me@example.com>", "Weekly report", "<p>report</p>"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d emails, want 1", len(messages))
+	}
+	if messages[0].From != "gofit@example.com" || len(messages[0].To) != 1 || messages[0].To[0] != "me@example.com" {
+		t.Errorf("envelope from %q to %q, want the bare addresses", messages[0].From, messages[0].To)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0].Data))
+	if err != nil {
+		t.Fatalf("failed to parse email: %v", err)
+	}
+	if from, err := msg.Header.AddressList("From"); err != nil || len(from) != 1 || from[0].Name != "Gofit" {
+		t.Errorf("From header %q lost the display name (%v)", msg.Header.Get("From"), err)
+	}
+	if to, err := msg.Header.AddressList("To"); err != nil || len(to) != 1 || to[0].Name != "Me" {
+		t.Errorf("To header %q lost the display name (%v)", msg.Header.Get("To"), err)
+	}
+}
+
+func TestSendNotConfigured(t *testing.T) {
+	if err := gomail.Send(config.SMTPConfig{}, "me@example.com", "subject", "body"); err == nil {
+		t.Error("Send without a server succeeded")
+	}
+}
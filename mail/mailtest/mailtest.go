@@ -0,0 +1,149 @@
+// Package mailtest runs a mail server for tests that keeps the emails it receives,
+// like httptest does for HTTP.
+package mailtest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gofit/config"
+)
+
+// Message is an email received by a Server
+type Message struct {
+	From string
+	To   []string
+	Data string // headers and body, with CRLF line endings
+}
+
+// Server is a local mail server offering neither STARTTLS nor authentication
+type Server struct {
+	Host string
+	Port int
+
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts a Server, which is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start mail server: %v", err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &Server{Host: addr.IP.String(), Port: addr.Port, ln: ln}
+	go s.serve()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// Config returns the settings that send emails from the address from through s
+func (s *Server) Config(from string) config.SMTPConfig {
+	return config.SMTPConfig{Host: s.Host, Port: s.Port, From: from}
+}
+
+// Messages returns the emails received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle speaks the part of SMTP net/smtp uses to send an email
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	}
+	reply("220 localhost mailtest")
+
+	var msg Message
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			reply("250-localhost", "250 8BITMIME")
+		case "HELO", "NOOP":
+			reply("250 OK")
+		case "RSET":
+			msg = Message{}
+			reply("250 OK")
+		case "MAIL":
+			from, ok := address(arg)
+			if !ok {
+				reply("553 Invalid sender address")
+				continue
+			}
+			msg = Message{From: from}
+			reply("250 OK")
+		case "RCPT":
+			to, ok := address(arg)
+			if !ok {
+				reply("553 Invalid recipient address")
+				continue
+			}
+			msg.To = append(msg.To, to)
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// address reads the address of a MAIL FROM:<a> or RCPT TO:<a> argument, which must
+// be bare like real servers expect, without a display name
+func address(arg string) (string, bool) {
+	_, path, _ := strings.Cut(arg, ":")
+	path, ok := strings.CutPrefix(path, "<")
+	if !ok {
+		return "", false
+	}
+	a, rest, ok := strings.Cut(path, ">")
+	if !ok || strings.ContainsAny(a, "<> ") || (rest != "" && !strings.HasPrefix(rest, " ")) {
+		return "", false
+	}
+	return a, true
+}
@@ -1,16 +1,149 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/gofit/config"
+	"github.com/gofit/logging"
+	"github.com/gofit/models"
+	"github.com/gofit/notify"
+	"github.com/gofit/reports"
 	"github.com/gofit/server"
 	"github.com/joho/godotenv"
 )
 
+const usage = `Usage: gofit <command> [flags]
+
+Commands:
+  serve                      run the dashboard (default)
+  sync [--days N] [--user]   download fresh data for all users or one user
+  auth login|logout|status   manage the Fitbit authorization of a user
+  login create --username    create the first dashboard login, password from stdin
+  export [--format csv|json] write the cached data of a user
+  report [--period P]        write the weekly or monthly report of all users or one user
+  notify test [--user]       send a test notification through every channel
+  status                     show last sync, token expiry and row counts
+  config print               show the effective configuration, secrets redacted
+
+Run 'gofit <command> -h' for the flags of a command.
+`
+
 func main() {
+	// The .env file is optional, settings can also come from the config file or the environment
 	err := godotenv.Load()
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal("Error loading .env file: ", err)
+	}
+
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		err = runServe(args)
+	case "sync":
+		err = runSync(args)
+	case "auth":
+		err = runAuth(args)
+	case "login":
+		err = runLogin(args)
+	case "export":
+		err = runExport(args)
+	case "report":
+		err = runReport(args)
+	case "notify":
+		err = runNotify(args)
+	case "status":
+		err = runStatus(args)
+	case "config":
+		err = runConfig(args)
+	case "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gofit:", err)
+		os.Exit(1)
+	}
+}
+
+// loadConfig parses the flags of a command together with the config flags
+// and applies the result to the models package
+func loadConfig(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	cfg, err := config.Load(fs, args)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands log to stderr only, the dashboard adds its log file once it starts
+	console := cfg.Log
+	console.File = ""
+	if _, err := logging.Setup(console, os.Stderr); err != nil {
+		return nil, err
+	}
+
+	var averages []int
+	for _, days := range []int{cfg.Dashboard.ShortAverage, cfg.Dashboard.LongAverage} {
+		if days > 0 {
+			averages = append(averages, days)
+		}
+	}
+	smoother := cfg.Dashboard.Smoother
+	if smoother == "none" {
+		smoother = ""
+	}
+	models.Configure(models.Settings{
+		ClientID:     cfg.OAuth.ClientID,
+		ClientSecret: cfg.OAuth.ClientSecret,
+		RedirectURI:  cfg.OAuth.RedirectURI,
+		RedirectPort: fmt.Sprint(cfg.OAuth.RedirectPort),
+		CacheMaxAge:  cfg.Cache.MaxAge.Duration,
+		// Only the dashboard may fall back to the browser flow, commands fail instead of waiting
+		Headless:         fs.Name() != "serve",
+		RollingAverages:  averages,
+		Smoother:         smoother,
+		AnomalyThreshold: cfg.Dashboard.AnomalyZScore,
+		AfterSync:        []func(string, error){reports.AfterSync, notify.AfterSync},
+	})
+	reports.Configure(reports.Settings{Report: cfg.Report, SMTP: cfg.SMTP})
+	notify.Configure(cfg.Notify, cfg.SMTP)
+
+	// Move a single-user data directory into the per-user layout
+	if err := models.MigrateLegacyDataDir(cfg.DataDir); err != nil {
+		return nil, fmt.Errorf("failed to migrate data directory: %w", err)
+	}
+	return cfg, nil
+}
+
+func runServe(args []string) error {
+	cfg, err := loadConfig(flag.NewFlagSet("serve", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	return server.Serve(cfg)
+}
+
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: gofit config print [flags]")
+	}
+	cfg, err := config.Load(flag.NewFlagSet("config print", flag.ContinueOnError), args[1:])
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return err
 	}
-	server.Serve()
+	return cfg.Redacted().Print(os.Stdout)
 }
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// LoadClientInfo reads the Fitbit client credentials stored for dataDir, falling back to the
+// configured defaults. The error satisfies os.IsNotExist when neither is available.
+func LoadClientInfo(dataDir string) (Config, error) {
+	var account_info Config
+	data, err := os.ReadFile(filepath.Join(dataDir, "account_info.json"))
+	if os.IsNotExist(err) && settings.ClientID != "" {
+		account_info.ClientID = settings.ClientID
+		account_info.ClientSecret = settings.ClientSecret
+		return account_info, nil
+	}
+	if err != nil {
+		return account_info, err
+	}
+	err = json.Unmarshal(data, &account_info)
+	return account_info, err
+}
+
+// SaveClientInfo stores the Fitbit client credentials for dataDir
+func SaveClientInfo(dataDir string, account_info Config) error {
+	err := os.MkdirAll(dataDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	data, err := json.MarshalIndent(account_info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal account info: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dataDir, "account_info.json"), data, 0600)
+}
+
+// Revocation is what happened to the Fitbit grant while disconnecting an account
+type Revocation string
+
+const (
+	// Revoked means the grant was revoked at Fitbit
+	Revoked Revocation = "revoked"
+	// RevokeNoToken means no token was stored, so there was nothing to revoke
+	RevokeNoToken Revocation = "no_token"
+	// RevokeSkipped means a token was stored but the client credentials to revoke it were missing
+	RevokeSkipped Revocation = "skipped"
+	// RevokeFailed means Fitbit did not revoke the grant, the local files are kept for a retry
+	RevokeFailed Revocation = "failed"
+)
+
+// DisconnectResult records what was done while disconnecting an account
+type DisconnectResult struct {
+	Revocation Revocation
+	// RevokeErr is why the revocation failed
+	RevokeErr error
+	Removed   []string
+}
+
+// DisconnectAccount revokes the Fitbit grant and deletes the stored credentials and tokens.
+// When purgeData is set everything else in dataDir is deleted as well: the cached health
+// data, goals, records, notifications and reports.
+func DisconnectAccount(clientID, clientSecret, dataDir string, purgeData bool) (*DisconnectResult, error) {
+	result := &DisconnectResult{}
+
+	downloader, err := newFitbitDownloader(clientID, clientSecret, dataDir)
+	if err != nil {
+		return result, err
+	}
+	if err := downloader.LoadTokenInfo(); err != nil {
+		slog.Info("No token information found, skipping revocation")
+		result.Revocation = RevokeNoToken
+	} else if clientID == "" || clientSecret == "" {
+		slog.Warn("Client credentials missing, unable to revoke token at Fitbit")
+		result.Revocation = RevokeSkipped
+	} else {
+		// Stop here if revocation fails so the grant can still be revoked on a retry
+		if err := downloader.RevokeToken(); err != nil {
+			result.Revocation, result.RevokeErr = RevokeFailed, err
+			return result, err
+		}
+		result.Revocation = Revoked
+	}
+
+	files := []string{"token_info.json", "account_info.json"}
+	if purgeData {
+		// Everything else in the user directory is health data or derived from it, such as
+		// the cache, records and reports. Listing the directory leaves no file behind.
+		entries, err := os.ReadDir(dataDir)
+		if err != nil && !os.IsNotExist(err) {
+			return result, fmt.Errorf("failed to list data directory: %w", err)
+		}
+		for _, entry := range entries {
+			if !slices.Contains(files, entry.Name()) {
+				files = append(files, entry.Name())
+			}
+		}
+	}
+
+	for _, name := range files {
+		path := filepath.Join(dataDir, name)
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+		slog.Info("Removed file", "path", path)
+		result.Removed = append(result.Removed, name)
+	}
+
+	if purgeData {
+		StoreFor(dataDir).reset()
+		slog.Info("Cleared in-memory data store")
+
+		// Drop the user directory once nothing is left in it
+		if err := os.Remove(dataDir); err == nil {
+			slog.Info("Removed data directory", "path", dataDir)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newDataDir returns a data directory holding the files of a synced account
+func newDataDir(t *testing.T) string {
+	t.Helper()
+	dataDir := filepath.Join(t.TempDir(), "users", "alice")
+	if err := os.MkdirAll(filepath.Join(dataDir, "reports"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"account_info.json", "cache.json", "goals.json", "records.json", "notifications.json", "reports/weekly-2025-10-06.html"} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dataDir
+}
+
+func TestDisconnectKeepsData(t *testing.T) {
+	dataDir := newDataDir(t)
+	result, err := DisconnectAccount("", "", dataDir, false)
+	if err != nil {
+		t.Fatalf("DisconnectAccount: %v", err)
+	}
+	if result.Revocation != RevokeNoToken {
+		t.Errorf("revocation %q, want %q", result.Revocation, RevokeNoToken)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "account_info.json")); !os.IsNotExist(err) {
+		t.Error("credentials kept")
+	}
+	for _, name := range []string{"cache.json", "records.json", "reports"} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err != nil {
+			t.Errorf("%s deleted without a purge: %v", name, err)
+		}
+	}
+}
+
+func TestDisconnectPurgesEveryFile(t *testing.T) {
+	dataDir := newDataDir(t)
+	// A file the purge does not know by name
+	if err := os.WriteFile(filepath.Join(dataDir, "future.json"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := DisconnectAccount("", "", dataDir, true)
+	if err != nil {
+		t.Fatalf("DisconnectAccount: %v", err)
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		entries, _ := os.ReadDir(dataDir)
+		t.Errorf("data directory kept with %v", entries)
+	}
+	if len(result.Removed) != 7 {
+		t.Errorf("removed %v, want the 7 entries of the directory", result.Removed)
+	}
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Aggregation is how the daily values of a chart point are combined
+type Aggregation string
+
+const (
+	Sum    Aggregation = "sum"
+	Mean   Aggregation = "mean"
+	Median Aggregation = "median"
+	Min    Aggregation = "min"
+	Max    Aggregation = "max"
+)
+
+// Aggregations lists the aggregations offered by the dashboard
+var Aggregations = []Aggregation{Mean, Sum, Median, Min, Max}
+
+// Granularities lists the chart granularities offered by the dashboard
+var Granularities = []Granularity{Daily, Weekly, Monthly, Yearly}
+
+// Rollup is how daily values are grouped into the points of a chart. An empty
+// Granularity is picked from the length of the range.
+type Rollup struct {
+	Granularity Granularity
+	Aggregation Aggregation
+}
+
+// ParseRollup reads a granularity and aggregation name, empty names and "auto" select the defaults
+func ParseRollup(granularity, aggregation string) (Rollup, bool) {
+	ro := Rollup{Aggregation: Mean}
+	if granularity != "" && granularity != "auto" {
+		if !slices.Contains(Granularities, Granularity(granularity)) {
+			return Rollup{}, false
+		}
+		ro.Granularity = Granularity(granularity)
+	}
+	if aggregation != "" {
+		if !slices.Contains(Aggregations, Aggregation(aggregation)) {
+			return Rollup{}, false
+		}
+		ro.Aggregation = Aggregation(aggregation)
+	}
+	return ro, true
+}
+
+// resolve fills in the granularity of an automatic rollup for r
+func (ro Rollup) resolve(r DateRange) Rollup {
+	if ro.Granularity == "" {
+		ro.Granularity = GranularityFor(r)
+	}
+	if ro.Aggregation == "" {
+		ro.Aggregation = Mean
+	}
+	return ro
+}
+
+// Aggregate combines values, 0 for no values
+func Aggregate(values []int, agg Aggregation) int {
+	if len(values) == 0 {
+		return 0
+	}
+	switch agg {
+	case Sum:
+		total := 0
+		for _, v := range values {
+			total += v
+		}
+		return total
+	case Median:
+		sorted := slices.Clone(values)
+		slices.Sort(sorted)
+		mid := len(sorted) / 2
+		if len(sorted)%2 == 1 {
+			return sorted[mid]
+		}
+		return int(math.Round(float64(sorted[mid-1]+sorted[mid]) / 2))
+	case Min:
+		return slices.Min(values)
+	case Max:
+		return slices.Max(values)
+	}
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return int(math.Round(float64(total) / float64(len(values))))
+}
+
+// aggregateDays combines value over days, leaving out days where it is zero when skipZero is set
+func aggregateDays(days []DayRecord, value func(DayRecord) int, skipZero bool, agg Aggregation) int {
+	values := make([]int, 0, len(days))
+	for _, day := range days {
+		v := value(day)
+		if skipZero && v == 0 {
+			continue
+		}
+		values = append(values, v)
+	}
+	return Aggregate(values, agg)
+}
+
+// aggregationPhrase names agg in chart subtitles
+func aggregationPhrase(agg Aggregation) string {
+	switch agg {
+	case Sum:
+		return "total"
+	case Median:
+		return "median"
+	case Min:
+		return "minimum"
+	case Max:
+		return "maximum"
+	}
+	return "average"
+}
+
+// bucket is one point of a chart, the days of the range falling in one granularity step
+type bucket struct {
+	start time.Time
+	label string
+	days  []DayRecord
+}
+
+// buckets groups the days of r downloaded for metric by g, skipping steps without data
+func (h *History) buckets(metric string, r DateRange, g Granularity) []bucket {
+	var out []bucket
+	var current time.Time
+	for date := r.From; !date.After(r.To); date = date.AddDate(0, 0, 1) {
+		if !h.Has(metric, date) {
+			continue
+		}
+		start := g.bucketStart(date)
+		if len(out) == 0 || !start.Equal(current) {
+			current = start
+			out = append(out, bucket{start: start, label: g.label(start, r)})
+		}
+		last := &out[len(out)-1]
+		last.days = append(last.days, h.Days[date.Format(time.DateOnly)])
+	}
+	return out
+}
+
+// activityValue returns the field of an activity metric
+func activityValue(metric string) func(DayRecord) int {
+	return func(day DayRecord) int {
+		switch metric {
+		case "steps":
+			return day.Steps
+		case "calories":
+			return day.Calories
+		case "elevation":
+			return day.Elevation
+		case "floors":
+			return day.Floors
+		case "active_minutes":
+			return day.FairlyActiveMinutes + day.VeryActiveMinutes
+		}
+		return 0
+	}
+}
+
+// rollupSubtitle describes the points of a chart drawn with ro
+func rollupSubtitle(ro Rollup, what string) string {
+	if ro.Granularity == Daily {
+		return "Daily " + what
+	}
+	period := cases.Title(language.English).String(string(ro.Granularity)) + "ly"
+	return period + " " + aggregationPhrase(ro.Aggregation) + " of daily " + what
+}
+
+// ActivityChart draws an activity metric over r, one point per granularity step of ro
+func (h *History) ActivityChart(metric string, r DateRange, ro Rollup) ChartData {
+	ro = ro.resolve(r)
+	buckets := h.buckets(metric, r, ro.Granularity)
+	series := cases.Title(language.English).String(strings.ReplaceAll(metric, "_", " "))
+	chart := ChartData{
+		Type:     metric,
+		Title:    series + " Over Time",
+		Subtitle: rollupSubtitle(ro, strings.ReplaceAll(metric, "_", " ")+" count"),
+		XAxis:    make([]string, len(buckets)),
+		Series:   map[string][]int{series: make([]int, len(buckets))},
+	}
+	value := activityValue(metric)
+	for i, b := range buckets {
+		chart.XAxis[i] = b.label
+		chart.Series[series][i] = aggregateDays(b.days, value, false, ro.Aggregation)
+	}
+	if m, ok := LookupMetric(metric); ok && ro.Granularity == Daily {
+		chart.Overlays = h.trendOverlays(m, r, buckets)
+		chart.Marks = h.anomalyMarks(m, r, buckets)
+	}
+	return chart
+}
+
+// HeartRateChart draws the heart rate zones and resting heart rate over r. Zone minutes
+// are shown as a share of the day so they are always averaged, resting heart rates are
+// combined with the aggregation of ro except that a sum of rates means nothing.
+func (h *History) HeartRateChart(r DateRange, ro Rollup) HeartChartData {
+	ro = ro.resolve(r)
+	if ro.Aggregation == Sum {
+		ro.Aggregation = Mean
+	}
+	buckets := h.buckets("heart_rate", r, ro.Granularity)
+	chart := HeartChartData{
+		Title:  "Heart Rate Over Time",
+		XAxis:  make([]string, len(buckets)),
+		Series: map[string][]HeartRateEntry{"Heart Rate": make([]HeartRateEntry, len(buckets))},
+	}
+	if ro.Granularity != Daily {
+		chart.Subtitle = rollupSubtitle(Rollup{ro.Granularity, Mean}, "zone minutes")
+		chart.RestingSubtitle = rollupSubtitle(ro, "resting heart rate")
+	}
+	for i, b := range buckets {
+		entry := HeartRateEntry{
+			Zones: make(map[string]int, len(HeartRateZones)),
+			// Days without a reading report no resting heart rate
+			RestingRate: aggregateDays(b.days, func(day DayRecord) int { return day.RestingHeartRate }, true, ro.Aggregation),
+		}
+		for _, zone := range HeartRateZones {
+			entry.Zones[zone] = aggregateDays(b.days, func(day DayRecord) int { return day.ZoneMinutes[zone] }, false, Mean)
+		}
+		chart.XAxis[i] = b.label
+		chart.Series["Heart Rate"][i] = entry
+	}
+	if m, ok := LookupMetric("resting_heart_rate"); ok && ro.Granularity == Daily {
+		chart.RestingOverlays = h.trendOverlays(m, r, buckets)
+		chart.RestingMarks = h.anomalyMarks(m, r, buckets)
+	}
+	return chart
+}
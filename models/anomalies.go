@@ -0,0 +1,131 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// anomalyBaselineDays is the length of the personal baseline a day is compared with
+const anomalyBaselineDays = 28
+
+// anomalyMinBaseline is the number of readings a baseline needs before days are judged
+const anomalyMinBaseline = 14
+
+// anomalyRule flags days where a metric moves in the direction that is a warning sign
+type anomalyRule struct {
+	metric string
+	// sign is 1 when rises are flagged, -1 for drops
+	sign float64
+	// unworn marks metrics that read 0 on days the tracker was not worn, such days are
+	// neither judged nor part of the baselines
+	unworn bool
+}
+
+// anomalyRules are watched for anomalies: a rising resting heart rate or falling heart rate
+// variability can announce illness or overtraining, a drop in steps shows a missed day
+var anomalyRules = []anomalyRule{
+	{"resting_heart_rate", 1, false},
+	{"hrv", -1, false},
+	{"steps", -1, true},
+}
+
+// Anomaly is a day where a metric strayed from its baseline
+type Anomaly struct {
+	Metric   DailyMetric
+	Date     time.Time
+	Value    int
+	Baseline float64 // mean of the baseline days
+	ZScore   float64 // distance from the baseline in standard deviations
+}
+
+// Anomalies returns the days of r where a watched metric deviates from the mean of the
+// days before it by at least threshold standard deviations, newest first
+func (h *History) Anomalies(r DateRange, threshold float64) []Anomaly {
+	var anomalies []Anomaly
+	for _, rule := range anomalyRules {
+		m, ok := LookupMetric(rule.metric)
+		if !ok {
+			continue
+		}
+		anomalies = append(anomalies, h.metricAnomalies(m, rule, r, threshold)...)
+	}
+	slices.SortStableFunc(anomalies, func(a, b Anomaly) int {
+		return b.Date.Compare(a.Date)
+	})
+	return anomalies
+}
+
+// metricAnomalies checks every day of r with a reading of m against its rolling baseline.
+// Today is still being recorded and is never judged against the full days before it.
+func (h *History) metricAnomalies(m DailyMetric, rule anomalyRule, r DateRange, threshold float64) []Anomaly {
+	if threshold <= 0 {
+		return nil
+	}
+	if yesterday := Today().AddDate(0, 0, -1); r.To.After(yesterday) {
+		r.To = yesterday
+	}
+	values := map[time.Time]int{}
+	for _, d := range h.daily(m, DateRange{From: r.From.AddDate(0, 0, -anomalyBaselineDays), To: r.To}) {
+		values[d.Date] = d.Value
+	}
+
+	var anomalies []Anomaly
+	for date := r.From; !date.After(r.To); date = date.AddDate(0, 0, 1) {
+		v, ok := values[date]
+		if !ok || (rule.unworn && v == 0) {
+			continue
+		}
+		var baseline []int
+		for day := date.AddDate(0, 0, -anomalyBaselineDays); day.Before(date); day = day.AddDate(0, 0, 1) {
+			if b, ok := values[day]; ok && !(rule.unworn && b == 0) {
+				baseline = append(baseline, b)
+			}
+		}
+		if len(baseline) < anomalyMinBaseline {
+			continue
+		}
+		average := mean(baseline)
+		deviation := stdDev(baseline, average)
+		if deviation == 0 {
+			continue
+		}
+		z := (float64(v) - average) / deviation
+		if z*rule.sign >= threshold {
+			anomalies = append(anomalies, Anomaly{Metric: m, Date: date, Value: v, Baseline: average, ZScore: z})
+		}
+	}
+	return anomalies
+}
+
+// anomalyMarks flags the points of a daily chart of m that are anomalies
+func (h *History) anomalyMarks(m DailyMetric, r DateRange, buckets []bucket) []ChartMark {
+	var marks []ChartMark
+	for _, rule := range anomalyRules {
+		if rule.metric != m.Name {
+			continue
+		}
+		found := map[time.Time]Anomaly{}
+		for _, a := range h.metricAnomalies(m, rule, r, settings.AnomalyThreshold) {
+			found[a.Date] = a
+		}
+		for _, b := range buckets {
+			if a, ok := found[b.start]; ok {
+				marks = append(marks, ChartMark{X: b.label, Value: a.Value, Name: formatZScore(a.ZScore)})
+			}
+		}
+	}
+	return marks
+}
+
+// formatZScore names a mark by its z-score, e.g. "+2.4σ"
+func formatZScore(z float64) string {
+	return fmt.Sprintf("%+.1fσ", z)
+}
+
+// RecentAnomalies returns the anomalies of the last days of the store, newest first
+func (s *DataStore) RecentAnomalies(days int) []Anomaly {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.History.Anomalies(LastDays(days), settings.AnomalyThreshold)
+}
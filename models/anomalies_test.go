@@ -0,0 +1,36 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// stepsHistory returns a history of steps over the days before today, ending yesterday
+// with last
+func stepsHistory(last int) History {
+	h := History{Days: map[string]DayRecord{}, Fetched: map[string]DateRange{}}
+	yesterday := Today().AddDate(0, 0, -1)
+	from := yesterday.AddDate(0, 0, -anomalyBaselineDays)
+	for i, d := 0, from; d.Before(yesterday); i, d = i+1, d.AddDate(0, 0, 1) {
+		h.Days[d.Format(time.DateOnly)] = DayRecord{Steps: 8000 + 400*(i%5)}
+	}
+	h.Days[yesterday.Format(time.DateOnly)] = DayRecord{Steps: last}
+	h.Fetched["steps"] = DateRange{From: from, To: Today()}
+	return h
+}
+
+func TestAnomaliesSkipUnwornDays(t *testing.T) {
+	yesterday := Today().AddDate(0, 0, -1)
+	r := DateRange{From: yesterday, To: yesterday}
+
+	h := stepsHistory(0)
+	if found := h.Anomalies(r, 2); len(found) > 0 {
+		t.Errorf("a day the tracker was not worn is an anomaly: %+v", found)
+	}
+
+	h = stepsHistory(500)
+	found := h.Anomalies(r, 2)
+	if len(found) != 1 || found[0].Metric.Name != "steps" || !found[0].Date.Equal(yesterday) {
+		t.Errorf("a day of 500 steps is not flagged: %+v", found)
+	}
+}
@@ -3,21 +3,23 @@ package models
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"time"
 )
 
-func cacheData(downloader *FitbitDownloader) error {
+func cacheData(dataDir string) error {
+	store := StoreFor(dataDir)
+	store.mu.RLock()
 	cache := CacheData{
-		Timestamp: time.Now().Unix(),
-		MaxDays:   MAX_DAYS,
-		Steps:     Store.StepsData,
-		Calories:  Store.CaloriesData,
-		Elevation: Store.ElevationData,
-		HeartRate: Store.HeartRateData,
-		Profile:   Store.ProfileData,
+		Timestamp: store.syncedAt.Unix(),
+		Profile:   store.ProfileData,
+		History:   store.History.clone(),
+
+		MetricSyncedAt: maps.Clone(store.metricSyncedAt),
 	}
+	store.mu.RUnlock()
 
 	// Marshal the data with indentation for readability
 	data, err := json.MarshalIndent(cache, "", "  ")
@@ -26,14 +28,22 @@ func cacheData(downloader *FitbitDownloader) error {
 	}
 
 	// Write to cache file
-	cacheFile := filepath.Join(downloader.DataDir, "cache.json")
-	err = os.WriteFile(cacheFile, data, 0644)
+	cacheFile := filepath.Join(dataDir, "cache.json")
+	err = writeFileAtomic(cacheFile, data, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write cache file: %w", err)
 	}
+	store.mu.Lock()
+	store.dirty = false
+	store.mu.Unlock()
 	return nil
 }
 
+// LoadCacheData reads the cached data of dataDir
+func LoadCacheData(dataDir string) (*CacheData, error) {
+	return loadCacheData(dataDir)
+}
+
 func loadCacheData(dataDir string) (*CacheData, error) {
 	cacheFile := filepath.Join(dataDir, "cache.json")
 
@@ -52,53 +62,10 @@ func loadCacheData(dataDir string) (*CacheData, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal cache data: %w", err)
 	}
-
-	return &cache, nil
-}
-
-func isCacheValid(cache *CacheData, maxAgeHours int) bool {
-	cacheTime := time.Unix(cache.Timestamp, 0)
-	age := time.Since(cacheTime)
-	return age.Hours() <= float64(maxAgeHours)
-}
-
-func filterDataByDays(data ChartData, days int) ChartData {
-	if len(data.XAxis) <= days {
-		return data
+	if len(cache.History.Days) == 0 && cache.Steps != nil {
+		cache.History = historyFromLegacy(&cache, time.Unix(cache.Timestamp, 0))
+		cache.Steps, cache.Calories, cache.Elevation, cache.HeartRate = nil, nil, nil, nil
 	}
 
-	startIdx := len(data.XAxis) - days
-
-	filtered := ChartData{
-		Type:    data.Type,
-		Title:    data.Title,
-		Subtitle: data.Subtitle,
-		XAxis:    data.XAxis[startIdx:],
-		Series:   make(map[string][]int),
-	}
-
-	for key, values := range data.Series {
-		filtered.Series[key] = values[startIdx:]
-	}
-	return filtered
-}
-
-func filterHeartDataByDays(data HeartChartData, days int) HeartChartData {
-	if len(data.XAxis) <= days {
-		return data
-	}
-
-	startIdx := len(data.XAxis) - days
-
-	filtered := HeartChartData{
-		Title:    data.Title,
-		Subtitle: data.Subtitle,
-		XAxis:    data.XAxis[startIdx:],
-		Series:   make(map[string][]HeartRateEntry),
-	}
-
-	for key, values := range data.Series {
-		filtered.Series[key] = values[startIdx:]
-	}
-	return filtered
+	return &cache, nil
 }
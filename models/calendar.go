@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+)
+
+// CalendarMetrics are the daily metrics offered on the calendar heatmap
+var CalendarMetrics = []string{"steps", "active_minutes", "resting_heart_rate", "sleep"}
+
+// CalendarData is one daily metric over a calendar year, drawn as a heatmap
+type CalendarData struct {
+	Title    string
+	Subtitle string
+	Year     int
+	Unit     string
+	// Days holds the value of every day with data, by date (2006-01-02)
+	Days map[string]int
+	// DayURL is the address of the day pages, the date is appended to it when a cell is clicked
+	DayURL string
+}
+
+// CalendarChart returns m for every day of year
+func (h *History) CalendarChart(m DailyMetric, year int) CalendarData {
+	data := CalendarData{
+		Title:    m.Label,
+		Subtitle: "Daily " + m.Unit,
+		Year:     year,
+		Unit:     m.Unit,
+		Days:     map[string]int{},
+	}
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for date := from; date.Year() == year; date = date.AddDate(0, 0, 1) {
+		if !h.Has(m.Source, date) {
+			continue
+		}
+		key := date.Format(time.DateOnly)
+		v := m.Value(h.Days[key])
+		if m.Rate && v == 0 {
+			continue
+		}
+		data.Days[key] = v
+	}
+	return data
+}
+
+// Calendar draws m over year from the data of the store
+func (s *DataStore) Calendar(m DailyMetric, year int) CalendarData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.History.CalendarChart(m, year)
+}
+
+// Day returns the record of date and the metrics downloaded for it
+func (s *DataStore) Day(date time.Time) (DayRecord, []DailyMetric) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var fetched []DailyMetric
+	for _, m := range DailyMetrics {
+		if s.History.Has(m.Source, date) {
+			fetched = append(fetched, m)
+		}
+	}
+	return s.History.Days[date.Format(time.DateOnly)], fetched
+}
@@ -2,11 +2,16 @@ package models
 
 import (
 	"bytes"
+	"maps"
 	"math"
+	"path"
+	"slices"
 	"strconv"
 
 	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/event"
 	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/gofit/static"
 )
 
 type ChartData struct {
@@ -15,13 +20,32 @@ type ChartData struct {
 	Subtitle string
 	XAxis    []string
 	Series   map[string][]int
+	// Goal is drawn as a horizontal line when set
+	Goal int
+	// Overlays are trend lines such as rolling averages drawn over the series, by name
+	Overlays map[string][]float64
+	// Marks flag single points, such as anomalies
+	Marks []ChartMark
+}
+
+// ChartMark flags one point of a chart
+type ChartMark struct {
+	X     string // label of the point on the x axis
+	Value int
+	Name  string
 }
 
 type HeartChartData struct {
 	Title    string
 	Subtitle string
-	XAxis    []string
-	Series   map[string][]HeartRateEntry
+	// RestingSubtitle describes the points of the resting heart rate chart
+	RestingSubtitle string
+	XAxis           []string
+	Series          map[string][]HeartRateEntry
+	// RestingOverlays are trend lines drawn over the resting heart rates
+	RestingOverlays map[string][]float64
+	// RestingMarks flag resting heart rates, such as anomalies
+	RestingMarks []ChartMark
 }
 
 type HeartRateEntry struct {
@@ -29,11 +53,20 @@ type HeartRateEntry struct {
 	RestingRate int
 }
 
+// chartInit loads echarts and its theme from the embedded assets once they are vendored,
+// otherwise from the go-echarts CDN
+func chartInit(init opts.Initialization) opts.Initialization {
+	if static.Has(static.EchartsJS) && static.Has(static.EchartsTheme) {
+		init.AssetsHost = static.Dir(path.Dir(static.EchartsJS))
+	}
+	return init
+}
+
 func (data *ChartData) GenerateLineChart() string {
 	line := charts.NewLine()
 
 	line.SetGlobalOptions(
-		charts.WithInitializationOpts(opts.Initialization{Theme: "macarons", Width: "100%"}),
+		charts.WithInitializationOpts(chartInit(opts.Initialization{Theme: "macarons", Width: "100%"})),
 		charts.WithTitleOpts(opts.Title{
 			Title:    data.Title,
 			Subtitle: data.Subtitle,
@@ -69,12 +102,28 @@ func (data *ChartData) GenerateLineChart() string {
 		)
 	}
 
-	// Add each series from the data
-	for name, values := range data.Series {
-		line.AddSeries(name, generateLineItems(values))
+	// Add each series from the data, sorted so colors stay put between renders
+	for i, name := range slices.Sorted(maps.Keys(data.Series)) {
+		var seriesOpts []charts.SeriesOpts
+		if i == 0 {
+			seriesOpts = append(seriesOpts, markOpts(data.Marks)...)
+		}
+		if i == 0 && data.Goal > 0 {
+			// The goal line belongs to the chart, one series carries it
+			seriesOpts = append(seriesOpts,
+				charts.WithMarkLineNameYAxisItemOpts(opts.MarkLineNameYAxisItem{Name: "Goal", YAxis: data.Goal}),
+				charts.WithMarkLineStyleOpts(opts.MarkLineStyle{
+					Symbol:    []string{"none", "none"},
+					LineStyle: &opts.LineStyle{Color: "#2e7d32", Type: "dashed"},
+					Label:     &opts.Label{Show: opts.Bool(true), Formatter: "Goal {c}"},
+				}),
+			)
+		}
+		line.AddSeries(name, generateLineItems(data.Series[name]), seriesOpts...)
 	}
 
 	line.SetSeriesOptions(charts.WithLineChartOpts(opts.LineChart{Smooth: opts.Bool(true)}))
+	addOverlays(line, data.Overlays)
 
 	var buf bytes.Buffer
 	line.Render(&buf)
@@ -82,6 +131,231 @@ func (data *ChartData) GenerateLineChart() string {
 	return buf.String()
 }
 
+// markOpts pins the marks on the series that carries them
+func markOpts(marks []ChartMark) []charts.SeriesOpts {
+	if len(marks) == 0 {
+		return nil
+	}
+	items := make([]opts.MarkPointNameCoordItem, len(marks))
+	for i, m := range marks {
+		items[i] = opts.MarkPointNameCoordItem{
+			Name:       m.Name,
+			Coordinate: []interface{}{m.X, m.Value},
+			Value:      m.Name,
+			Symbol:     "pin",
+			SymbolSize: 40,
+			ItemStyle:  &opts.ItemStyle{Color: "#c0392b"},
+		}
+	}
+	return []charts.SeriesOpts{charts.WithMarkPointNameCoordItemOpts(items...)}
+}
+
+// addOverlays draws trend lines over a chart with a legend to toggle them
+func addOverlays(line *charts.Line, overlays map[string][]float64) {
+	if len(overlays) == 0 {
+		return
+	}
+	for _, name := range slices.Sorted(maps.Keys(overlays)) {
+		items := make([]opts.LineData, len(overlays[name]))
+		for i, v := range overlays[name] {
+			// Points without enough data are left out of the line
+			items[i] = opts.LineData{Value: v}
+			if math.IsNaN(v) {
+				items[i].Value = "-"
+			}
+		}
+		line.AddSeries(name, items,
+			charts.WithLineChartOpts(opts.LineChart{ShowSymbol: opts.Bool(false), Smooth: opts.Bool(true)}),
+			charts.WithLineStyleOpts(opts.LineStyle{Width: 2, Type: "dashed"}),
+		)
+	}
+	line.SetGlobalOptions(
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(true), Bottom: "0"}),
+		charts.WithGridOpts(opts.Grid{Bottom: "20%"}),
+	)
+}
+
+// GenerateCalendarHeatmap draws the year of data as a heatmap of days, one column per
+// week like a contribution graph. Clicking a day opens its page.
+func (data *CalendarData) GenerateCalendarHeatmap() string {
+	heatmap := charts.NewHeatMap()
+
+	low, high := 0, 0
+	items := make([]opts.HeatMapData, 0, len(data.Days))
+	for _, date := range slices.Sorted(maps.Keys(data.Days)) {
+		v := data.Days[date]
+		if len(items) == 0 || v < low {
+			low = v
+		}
+		high = max(high, v)
+		items = append(items, opts.HeatMapData{Value: []interface{}{date, v}})
+	}
+
+	heatmap.SetGlobalOptions(
+		charts.WithInitializationOpts(chartInit(opts.Initialization{Theme: "macarons", Width: "100%", Height: "260px"})),
+		charts.WithTitleOpts(opts.Title{
+			Title:    data.Title + " " + strconv.Itoa(data.Year),
+			Subtitle: data.Subtitle,
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{
+			Show:      opts.Bool(true),
+			Formatter: opts.FuncOpts(`(params) => params.value[0] + ": " + params.value[1] + " ` + data.Unit + `"`),
+		}),
+		charts.WithVisualMapOpts(opts.VisualMap{
+			Calculable: opts.Bool(true),
+			Min:        float32(low),
+			Max:        float32(high),
+			Orient:     "horizontal",
+			Left:       "center",
+			Bottom:     "0",
+			InRange:    &opts.VisualMapInRange{Color: []string{"#ebedf0", "#9be9a8", "#40c463", "#30a14e", "#216e39"}},
+		}),
+	)
+	if data.DayURL != "" {
+		heatmap.SetGlobalOptions(charts.WithEventListeners(event.Listener{
+			EventName: "click",
+			Handler:   opts.FuncOpts(`(params) => { window.location = "` + data.DayURL + `" + params.value[0]; }`),
+		}))
+	}
+
+	heatmap.AddCalendar(&opts.Calendar{
+		Top:       "80",
+		Left:      "40",
+		Right:     "20",
+		CellSize:  "auto",
+		Range:     []string{strconv.Itoa(data.Year)},
+		YearLabel: &opts.CalendarLabel{Show: opts.Bool(false)},
+	})
+	heatmap.AddSeries(data.Title, items, charts.WithCoordinateSystem("calendar"))
+
+	var buf bytes.Buffer
+	heatmap.Render(&buf)
+
+	return buf.String()
+}
+
+// GenerateTrainingLoadChart draws the daily load as bars under fitness, fatigue and form
+// lines, with the acute:chronic ratio on a second axis
+func (data *TrainingLoadData) GenerateTrainingLoadChart() string {
+	bar := charts.NewBar()
+	bar.SetGlobalOptions(
+		charts.WithInitializationOpts(chartInit(opts.Initialization{Theme: "macarons", Width: "100%"})),
+		charts.WithTitleOpts(opts.Title{
+			Title:    data.Title,
+			Subtitle: data.Subtitle,
+		}),
+		charts.WithXAxisOpts(opts.XAxis{
+			AxisLabel: &opts.AxisLabel{
+				Rotate: 45,
+			},
+		}),
+		charts.WithYAxisOpts(opts.YAxis{Name: "Load"}),
+		charts.WithTooltipOpts(opts.Tooltip{
+			Show:    opts.Bool(true),
+			Trigger: "axis",
+		}),
+		charts.WithLegendOpts(opts.Legend{
+			Show:   opts.Bool(true),
+			Bottom: "0",
+			// The ratio has its own scale, it is shown on demand
+			Selected: map[string]bool{"Acute:chronic ratio": false},
+		}),
+		charts.WithGridOpts(opts.Grid{Bottom: "20%"}),
+	)
+	bar.ExtendYAxis(opts.YAxis{Name: "Ratio", Position: "right", SplitLine: &opts.SplitLine{Show: opts.Bool(false)}})
+	bar.SetXAxis(data.XAxis)
+	bar.AddSeries("Daily load", generateBarItems(data.Load))
+
+	lines := charts.NewLine()
+	lines.SetXAxis(data.XAxis)
+	for _, s := range []struct {
+		name   string
+		values []float64
+	}{
+		{"Fitness (42-day)", data.Fitness},
+		{"Fatigue (7-day)", data.Fatigue},
+		{"Form", data.Form},
+	} {
+		lines.AddSeries(s.name, generateFloatLineItems(s.values),
+			charts.WithLineChartOpts(opts.LineChart{ShowSymbol: opts.Bool(false), Smooth: opts.Bool(true)}))
+	}
+	lines.AddSeries("Acute:chronic ratio", generateFloatLineItems(data.Ratio),
+		charts.WithLineChartOpts(opts.LineChart{ShowSymbol: opts.Bool(false), YAxisIndex: 1}),
+		charts.WithLineStyleOpts(opts.LineStyle{Type: "dashed"}),
+		charts.WithMarkLineNameYAxisItemOpts(opts.MarkLineNameYAxisItem{Name: "Overreaching", YAxis: overreachingRatio}),
+	)
+	bar.Overlap(lines)
+
+	var buf bytes.Buffer
+	bar.Render(&buf)
+
+	return buf.String()
+}
+
+// GenerateScatterChart plots the pairs of two metrics with their regression line
+func (data *ScatterData) GenerateScatterChart() string {
+	scatter := charts.NewScatter()
+	scatter.SetGlobalOptions(
+		charts.WithInitializationOpts(chartInit(opts.Initialization{Theme: "macarons", Width: "100%", Height: "500px"})),
+		charts.WithTitleOpts(opts.Title{
+			Title:    data.Title,
+			Subtitle: data.Subtitle,
+		}),
+		charts.WithXAxisOpts(opts.XAxis{
+			Type:         "value",
+			Name:         data.XName,
+			NameLocation: "middle",
+			NameGap:      30,
+			Scale:        opts.Bool(true),
+		}),
+		charts.WithYAxisOpts(opts.YAxis{
+			Type:         "value",
+			Name:         data.YName,
+			NameLocation: "middle",
+			NameGap:      50,
+			Scale:        opts.Bool(true),
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{
+			Show:      opts.Bool(true),
+			Trigger:   "item",
+			Formatter: opts.FuncOpts(`(params) => params.value[0] + ", " + params.value[1]`),
+		}),
+	)
+
+	items := make([]opts.ScatterData, len(data.Points))
+	for i, p := range data.Points {
+		items[i] = opts.ScatterData{Value: []int{p[0], p[1]}, SymbolSize: 8}
+	}
+	var seriesOpts []charts.SeriesOpts
+	if data.Line != nil {
+		seriesOpts = append(seriesOpts,
+			charts.WithMarkLineNameCoordItemOpts(opts.MarkLineNameCoordItem{
+				Name:        "Regression",
+				Coordinate0: []interface{}{data.Line[0][0], data.Line[0][1]},
+				Coordinate1: []interface{}{data.Line[1][0], data.Line[1][1]},
+			}),
+			charts.WithMarkLineStyleOpts(opts.MarkLineStyle{
+				Symbol:    []string{"none", "none"},
+				LineStyle: &opts.LineStyle{Color: "#c0392b", Width: 2},
+			}),
+		)
+	}
+	scatter.AddSeries("Days", items, seriesOpts...)
+
+	var buf bytes.Buffer
+	scatter.Render(&buf)
+
+	return buf.String()
+}
+
+func generateFloatLineItems(data []float64) []opts.LineData {
+	items := make([]opts.LineData, 0, len(data))
+	for _, v := range data {
+		items = append(items, opts.LineData{Value: v})
+	}
+	return items
+}
+
 func generateLineItems(data []int) []opts.LineData {
 	items := make([]opts.LineData, 0, len(data))
 	for _, v := range data {
@@ -102,7 +376,7 @@ func (data *HeartChartData) GenerateHeartRateChart() string {
 	bar := charts.NewBar()
 
 	bar.SetGlobalOptions(
-		charts.WithInitializationOpts(opts.Initialization{Theme: "macarons"}),
+		charts.WithInitializationOpts(chartInit(opts.Initialization{Theme: "macarons"})),
 		charts.WithTitleOpts(opts.Title{
 			Title:    data.Title,
 			Subtitle: data.Subtitle,
@@ -193,10 +467,10 @@ func (data *HeartChartData) GenerateRestingHeartRateChart() string {
 	line := charts.NewBar()
 
 	line.SetGlobalOptions(
-		charts.WithInitializationOpts(opts.Initialization{Theme: "macarons"}),
+		charts.WithInitializationOpts(chartInit(opts.Initialization{Theme: "macarons"})),
 		charts.WithTitleOpts(opts.Title{
 			Title:    "Resting Heart Rate Over Time",
-			Subtitle: data.Subtitle,
+			Subtitle: data.RestingSubtitle,
 		}),
 		charts.WithXAxisOpts(opts.XAxis{
 			AxisLabel: &opts.AxisLabel{
@@ -231,10 +505,21 @@ func (data *HeartChartData) GenerateRestingHeartRateChart() string {
 	}
 
 	// Add resting heart rate series
-	line.AddSeries("Resting Heart Rate", generateBarItems(restingRates))
+	line.AddSeries("Resting Heart Rate", generateBarItems(restingRates), markOpts(data.RestingMarks)...)
 
 	line.SetSeriesOptions(charts.WithLineChartOpts(opts.LineChart{Smooth: opts.Bool(true)}))
 
+	if len(data.RestingOverlays) > 0 {
+		trends := charts.NewLine()
+		trends.SetXAxis(data.XAxis)
+		addOverlays(trends, data.RestingOverlays)
+		line.Overlap(trends)
+		line.SetGlobalOptions(
+			charts.WithLegendOpts(opts.Legend{Show: opts.Bool(true), Bottom: "0"}),
+			charts.WithGridOpts(opts.Grid{Bottom: "20%"}),
+		)
+	}
+
 	var buf bytes.Buffer
 	line.Render(&buf)
 
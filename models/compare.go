@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// CompareMode picks the window a date range is compared with
+type CompareMode string
+
+const (
+	// ComparePrevious compares with the same number of days right before the range
+	ComparePrevious CompareMode = "previous"
+	// CompareYear compares with the same dates a year earlier
+	CompareYear CompareMode = "year"
+)
+
+// CompareModes lists the comparisons offered by the dashboard
+var CompareModes = []CompareMode{ComparePrevious, CompareYear}
+
+// ParseCompareMode reads a comparison name, "" and "off" disable comparing
+func ParseCompareMode(name string) (CompareMode, bool) {
+	if name == "" || name == "off" {
+		return "", true
+	}
+	if !slices.Contains(CompareModes, CompareMode(name)) {
+		return "", false
+	}
+	return CompareMode(name), true
+}
+
+// Range returns the window r is compared with
+func (m CompareMode) Range(r DateRange) DateRange {
+	if m == CompareYear {
+		return DateRange{From: r.From.AddDate(-1, 0, 0), To: r.To.AddDate(-1, 0, 0)}
+	}
+	days := r.Days()
+	return DateRange{From: r.From.AddDate(0, 0, -days), To: r.To.AddDate(0, 0, -days)}
+}
+
+// Comparison overlays a date range with an earlier window of the same length
+type Comparison struct {
+	Mode     CompareMode
+	Current  DateRange
+	Previous DateRange
+	// Charts holds one overlay chart per daily metric, by name
+	Charts map[string]ChartData
+	Deltas []MetricDelta
+}
+
+// MetricDelta is the change of the daily average of a metric between the two windows
+type MetricDelta struct {
+	Metric   DailyMetric
+	Current  float64
+	Previous float64
+	// Percent is the change relative to Previous, only meaningful when Comparable
+	Percent    float64
+	Comparable bool
+}
+
+// Compare overlays every daily metric over r with the window picked by mode. Points are
+// aligned by their position in the window, day 1 with day 1, so both windows share an x axis.
+func (h *History) Compare(r DateRange, ro Rollup, mode CompareMode) *Comparison {
+	ro = ro.resolve(r)
+	c := &Comparison{
+		Mode:     mode,
+		Current:  r,
+		Previous: mode.Range(r),
+		Charts:   make(map[string]ChartData, len(DailyMetrics)),
+	}
+
+	for _, m := range DailyMetrics {
+		mro := Rollup{ro.Granularity, m.aggregation(ro.Aggregation)}
+		current := h.alignedSeries(m, c.Current, mro)
+		previous := h.alignedSeries(m, c.Previous, mro)
+
+		points := max(len(current), len(previous))
+		chart := ChartData{
+			Type:     m.Name,
+			Title:    m.Label + " compared",
+			Subtitle: rollupSubtitle(mro, m.Unit),
+			XAxis:    make([]string, points),
+			Series: map[string][]int{
+				c.Current.String():  current,
+				c.Previous.String(): previous,
+			},
+		}
+		for i := range chart.XAxis {
+			chart.XAxis[i] = fmt.Sprintf("%s %d", periodName(ro.Granularity), i+1)
+		}
+		c.Charts[m.Name] = chart
+
+		delta := MetricDelta{
+			Metric:   m,
+			Current:  mean(h.values(m, c.Current)),
+			Previous: mean(h.values(m, c.Previous)),
+		}
+		if delta.Previous != 0 {
+			delta.Percent = (delta.Current - delta.Previous) / delta.Previous * 100
+			delta.Comparable = true
+		}
+		c.Deltas = append(c.Deltas, delta)
+	}
+	return c
+}
+
+// alignedSeries aggregates m over consecutive buckets of the granularity of ro counted from
+// the start of r: runs of 7 days, or months and years from the day r starts, so bucket i
+// of two windows covers as many days. Unlike the buckets of a regular chart, buckets
+// without data are kept as 0 so the positions of two windows line up.
+func (h *History) alignedSeries(m DailyMetric, r DateRange, ro Rollup) []int {
+	var values []int
+	for i := 0; ; i++ {
+		// Shifted from r.From each time so months do not drift after a short one
+		start := ro.Granularity.shift(r.From, i)
+		if start.After(r.To) {
+			break
+		}
+		end := ro.Granularity.shift(r.From, i+1)
+		var days []DayRecord
+		for date := start; date.Before(end) && !date.After(r.To); date = date.AddDate(0, 0, 1) {
+			if h.Has(m.Source, date) {
+				days = append(days, h.Days[date.Format(time.DateOnly)])
+			}
+		}
+		values = append(values, aggregateDays(days, m.Value, m.Rate, ro.Aggregation))
+	}
+	return values
+}
+
+// periodName names the points of an aligned chart
+func periodName(g Granularity) string {
+	switch g {
+	case Weekly:
+		return "Week"
+	case Monthly:
+		return "Month"
+	case Yearly:
+		return "Year"
+	}
+	return "Day"
+}
+
+// mean averages values, 0 for no values
+func mean(values []int) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0
+	for _, v := range values {
+		total += v
+	}
+	return float64(total) / float64(len(values))
+}
@@ -0,0 +1,178 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// MaxCorrelationLag is the largest number of days a metric can be shifted by
+const MaxCorrelationLag = 14
+
+// CorrelationPoint pairs the values of two metrics, X taken Lag days before Y
+type CorrelationPoint struct {
+	Date time.Time // the day of Y
+	X    int
+	Y    int
+}
+
+// Correlation relates two daily metrics over a date range
+type Correlation struct {
+	X, Y   DailyMetric
+	Lag    int
+	Range  DateRange
+	Points []CorrelationPoint
+	// Pearson measures a linear relation, Spearman a monotonic one, both from -1 to 1.
+	// They are only meaningful with at least 3 points.
+	Pearson  float64
+	Spearman float64
+	// Slope and Intercept are the least squares line of Y over X
+	Slope     float64
+	Intercept float64
+}
+
+// Correlate pairs y on each day of r with x lag days earlier, skipping days missing either
+func (h *History) Correlate(x, y DailyMetric, lag int, r DateRange) Correlation {
+	c := Correlation{X: x, Y: y, Lag: lag, Range: r}
+	xs := map[time.Time]int{}
+	for _, d := range h.daily(x, DateRange{From: r.From.AddDate(0, 0, -lag), To: r.To.AddDate(0, 0, -lag)}) {
+		xs[d.Date] = d.Value
+	}
+	for _, d := range h.daily(y, r) {
+		if v, ok := xs[d.Date.AddDate(0, 0, -lag)]; ok {
+			c.Points = append(c.Points, CorrelationPoint{Date: d.Date, X: v, Y: d.Value})
+		}
+	}
+	if len(c.Points) < 3 {
+		return c
+	}
+
+	xv := make([]float64, len(c.Points))
+	yv := make([]float64, len(c.Points))
+	for i, p := range c.Points {
+		xv[i], yv[i] = float64(p.X), float64(p.Y)
+	}
+	c.Pearson = pearson(xv, yv)
+	c.Spearman = pearson(ranks(xv), ranks(yv))
+	c.Slope, c.Intercept = regression(xv, yv)
+	return c
+}
+
+// Correlate relates two metrics of the store over r
+func (s *DataStore) Correlate(x, y DailyMetric, lag int, r DateRange) Correlation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.History.Correlate(x, y, lag, r)
+}
+
+// pearson returns the correlation coefficient of xs and ys, 0 when either is constant
+func pearson(xs, ys []float64) float64 {
+	n := float64(len(xs))
+	var sx, sy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+		vx += (xs[i] - mx) * (xs[i] - mx)
+		vy += (ys[i] - my) * (ys[i] - my)
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// ranks replaces values by their rank from 1, tied values sharing the mean of their ranks
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		switch {
+		case values[a] < values[b]:
+			return -1
+		case values[a] > values[b]:
+			return 1
+		}
+		return 0
+	})
+	out := make([]float64, len(values))
+	for i := 0; i < len(order); {
+		j := i
+		for j+1 < len(order) && values[order[j+1]] == values[order[i]] {
+			j++
+		}
+		rank := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			out[order[k]] = rank
+		}
+		i = j + 1
+	}
+	return out
+}
+
+// regression fits ys = intercept + slope * xs by least squares
+func regression(xs, ys []float64) (slope, intercept float64) {
+	n := float64(len(xs))
+	var sx, sy, sxy, sxx float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxy += xs[i] * ys[i]
+		sxx += xs[i] * xs[i]
+	}
+	if d := n*sxx - sx*sx; d != 0 {
+		slope = (n*sxy - sx*sy) / d
+	}
+	return slope, (sy - slope*sx) / n
+}
+
+// ScatterData is a correlation drawn as a scatter plot with its regression line
+type ScatterData struct {
+	Title    string
+	Subtitle string
+	XName    string
+	YName    string
+	Points   [][2]int
+	// Line runs from the lowest to the highest X, nil without a fit
+	Line *[2][2]float64
+}
+
+// ScatterChart describes c for GenerateScatterChart
+func (c Correlation) ScatterChart() ScatterData {
+	data := ScatterData{
+		Title: c.Y.Label + " vs " + c.X.Label,
+		XName: c.X.Label + " (" + c.X.Unit + ")",
+		YName: c.Y.Label + " (" + c.Y.Unit + ")",
+	}
+	if c.Lag > 0 {
+		data.XName = c.X.Label + " " + lagPhrase(c.Lag) + " (" + c.X.Unit + ")"
+	}
+	data.Subtitle = c.Range.String()
+	low, high := math.MaxInt, math.MinInt
+	for _, p := range c.Points {
+		data.Points = append(data.Points, [2]int{p.X, p.Y})
+		low, high = min(low, p.X), max(high, p.X)
+	}
+	if len(c.Points) >= 3 && low < high {
+		data.Line = &[2][2]float64{
+			{float64(low), round1(c.Intercept + c.Slope*float64(low))},
+			{float64(high), round1(c.Intercept + c.Slope*float64(high))},
+		}
+	}
+	return data
+}
+
+// lagPhrase names a shift of days, "the day before" or "3 days before"
+func lagPhrase(lag int) string {
+	if lag == 1 {
+		return "the day before"
+	}
+	return strconv.Itoa(lag) + " days before"
+}
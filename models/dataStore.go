@@ -1,175 +1,535 @@
 package models
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
-	"strconv"
 	"sync"
+	"time"
 )
 
-const MAX_DAYS = 28
+// Settings holds the configurable behaviour of the models package
+type Settings struct {
+	// ClientID and ClientSecret are used by data directories without an account_info.json
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	RedirectPort string
+	CacheMaxAge  time.Duration
+	// Headless disables the browser authorization flow, commands run from cron fail instead of waiting
+	Headless bool
+	// RollingAverages are the windows in days of the averages drawn over daily charts
+	RollingAverages []int
+	// Smoother adds a trend line to daily charts, SmootherEMA, SmootherLOESS or "" for none
+	Smoother string
+	// AnomalyThreshold is the z-score from which a day is flagged as an anomaly, 0 disables the detection
+	AnomalyThreshold float64
+	// AfterSync run after every sync of a data directory, with the error it ended with
+	AfterSync []func(dataDir string, err error)
+}
+
+var settings = Settings{
+	RedirectURI:      "http://fitbit-pi.local",
+	RedirectPort:     "8080",
+	CacheMaxAge:      2 * time.Hour,
+	RollingAverages:  []int{7, 30},
+	AnomalyThreshold: 2,
+}
+
+// Configure replaces the package settings, call it before any data is loaded
+func Configure(s Settings) {
+	settings = s
+}
 
 type DataStore struct {
-	StepsData     ChartData
-	CaloriesData  ChartData
-	ElevationData ChartData
-	ProfileData   ProfileData
-	HeartRateData HeartChartData
+	mu sync.RWMutex // guards the fields, syncs write while handlers read
+
+	History     History
+	ProfileData ProfileData
+
+	syncedAt       time.Time            // when the data was downloaded
+	metricSyncedAt map[string]time.Time // when each metric was last downloaded successfully
+	dirty          bool                 // downloaded data that is not yet written to the cache
+}
+
+// StoreView is the data of a store drawn for one date range, safe to use while a sync runs
+type StoreView struct {
+	Range         DateRange
+	Rollup        Rollup // with the granularity picked for automatic rollups
+	Steps         ChartData
+	Calories      ChartData
+	Elevation     ChartData
+	Floors        ChartData
+	ActiveMinutes ChartData
+	HeartRate     HeartChartData
+	TrainingLoad  TrainingLoadData
+	Profile       ProfileData
+	SyncedAt      time.Time
+	// Comparison is set when the range is compared with an earlier window
+	Comparison *Comparison
+	// Summaries describes each daily metric over Range, by name
+	Summaries map[string]Summary
+}
+
+// View draws the data of the store over r with one point per granularity step of ro
+func (s *DataStore) View(r DateRange, ro Rollup) StoreView {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return StoreView{
+		Range:         r,
+		Rollup:        ro.resolve(r),
+		Steps:         s.History.ActivityChart("steps", r, ro),
+		Calories:      s.History.ActivityChart("calories", r, ro),
+		Elevation:     s.History.ActivityChart("elevation", r, ro),
+		Floors:        s.History.ActivityChart("floors", r, ro),
+		ActiveMinutes: s.History.ActivityChart("active_minutes", r, ro),
+		HeartRate:     s.History.HeartRateChart(r, ro),
+		TrainingLoad:  s.History.TrainingLoadChart(r),
+		Profile:       s.ProfileData,
+		SyncedAt:      s.syncedAt,
+	}
+}
+
+// SetGoals draws the daily goals on the charts of the view. Totals of weeks or months
+// cannot be held against a daily goal, those charts stay without a line.
+func (v *StoreView) SetGoals(goals Goals) {
+	if v.Rollup.Aggregation == Sum && v.Rollup.Granularity != Daily {
+		return
+	}
+	for metric, chart := range map[string]*ChartData{
+		"steps":          &v.Steps,
+		"calories":       &v.Calories,
+		"floors":         &v.Floors,
+		"active_minutes": &v.ActiveMinutes,
+	} {
+		chart.Goal = goals[metric]
+	}
+	if v.Comparison == nil {
+		return
+	}
+	for metric, chart := range v.Comparison.Charts {
+		chart.Goal = goals[metric]
+		v.Comparison.Charts[metric] = chart
+	}
+}
+
+// Compare overlays the data of the store over r with the window picked by mode
+func (s *DataStore) Compare(r DateRange, ro Rollup, mode CompareMode) *Comparison {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.History.Compare(r, ro, mode)
+}
+
+// Profile returns the downloaded Fitbit profile
+func (s *DataStore) Profile() ProfileData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ProfileData
+}
+
+// SyncedAt returns when the data was last downloaded
+func (s *DataStore) SyncedAt() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.syncedAt
+}
+
+// Earliest returns the first day with data, the zero time before the first sync
+func (s *DataStore) Earliest() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.History.Earliest()
+}
+
+// reset drops all data held in memory
+func (s *DataStore) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.History = History{}
+	s.ProfileData = ProfileData{}
+	s.syncedAt = time.Time{}
+	s.metricSyncedAt = nil
+	s.dirty = false
 }
 
-var Store = DataStore{
-	StepsData:     ChartData{},
-	CaloriesData:  ChartData{},
-	ProfileData:   ProfileData{},
-	ElevationData: ChartData{},
-	HeartRateData: HeartChartData{},
+var (
+	// activeSyncs tracks downloads in progress so shutdown can wait for them
+	activeSyncs sync.WaitGroup
+	// activeSyncsMu orders adding to activeSyncs against shuttingDown, so no sync starts
+	// after WaitForSyncs began waiting
+	activeSyncsMu sync.Mutex
+	shuttingDown  bool
+)
+
+// ErrShuttingDown is returned for syncs requested after shutdown began
+var ErrShuttingDown = errors.New("shutting down, sync not started")
+
+// beginSync adds a sync to activeSyncs, it returns false once shutdown began
+func beginSync() bool {
+	activeSyncsMu.Lock()
+	defer activeSyncsMu.Unlock()
+	if shuttingDown {
+		return false
+	}
+	activeSyncs.Add(1)
+	return true
 }
 
+// WaitForSyncs refuses new syncs and blocks until all running syncs have finished or ctx is done
+func WaitForSyncs(ctx context.Context) error {
+	activeSyncsMu.Lock()
+	shuttingDown = true
+	activeSyncsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		activeSyncs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FlushStores writes every store holding data that has not reached its cache file yet
+func FlushStores() error {
+	storesMu.Lock()
+	dirty := map[string]*DataStore{}
+	for dataDir, store := range stores {
+		store.mu.RLock()
+		if store.dirty {
+			dirty[dataDir] = store
+		}
+		store.mu.RUnlock()
+	}
+	storesMu.Unlock()
+
+	var errs []error
+	for dataDir := range dirty {
+		if err := cacheData(dataDir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		slog.Info("Flushed data store", "dir", dataDir)
+	}
+	return errors.Join(errs...)
+}
+
+// PopulateDataStore fills the store of dataDir from the cache or, when it is stale, from Fitbit
 func PopulateDataStore(clientID, clientSecret, dataDir string, requestedDays int) error {
-	cache, err := loadCacheData(dataDir)
-	if err == nil && isCacheValid(cache, 2) {
-		log.Println("Using cached data")
-		Store.StepsData = filterDataByDays(cache.Steps, requestedDays)
-		Store.CaloriesData = filterDataByDays(cache.Calories, requestedDays)
-		Store.ElevationData = filterDataByDays(cache.Elevation, requestedDays)
-		Store.HeartRateData = filterHeartDataByDays(cache.HeartRate, requestedDays)
-		Store.ProfileData = cache.Profile
+	stale, err := LoadDataStore(dataDir)
+	if err == nil && !stale {
 		return nil
 	}
+	return SyncDataStore(clientID, clientSecret, dataDir, requestedDays)
+}
+
+// LoadDataStore fills the store of dataDir from its cache file whatever its age, unless the
+// store already holds data. It reports whether the data is older than the cache max age,
+// and returns an error when there is no data at all.
+func LoadDataStore(dataDir string) (stale bool, err error) {
+	store := StoreFor(dataDir)
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if store.syncedAt.IsZero() {
+		cache, err := loadCacheData(dataDir)
+		if err != nil {
+			return true, err
+		}
+		slog.Debug("Loaded cached data", "dir", dataDir)
+		store.History = cache.History
+		store.ProfileData = cache.Profile
+		store.syncedAt = time.Unix(cache.Timestamp, 0)
+		store.metricSyncedAt = cache.MetricSyncedAt
+	}
+	return time.Since(store.syncedAt) > settings.CacheMaxAge, nil
+}
 
-	downloader := newFitbitDownloader(clientID, clientSecret, dataDir)
+// SyncDataStore downloads the data missing from the store of dataDir for the last requestedDays,
+// or since the account was created when requestedDays is 0, and rewrites the cache. Progress is reported to the watchers of a sync started with StartSync.
+// The metrics that failed to download are returned as errors, those downloaded are kept.
+func SyncDataStore(clientID, clientSecret, dataDir string, requestedDays int) error {
+	if !beginSync() {
+		return ErrShuttingDown
+	}
+	defer activeSyncs.Done()
+	return runSync(clientID, clientSecret, dataDir, requestedDays)
+}
+
+// runSync runs a sync already added to activeSyncs and the AfterSync hooks
+func runSync(clientID, clientSecret, dataDir string, requestedDays int) error {
+	err := syncDataStore(clientID, clientSecret, dataDir, requestedDays)
+	for _, hook := range settings.AfterSync {
+		hook(dataDir, err)
+	}
+	return err
+}
+
+// syncDataStore runs the downloads of SyncDataStore
+func syncDataStore(clientID, clientSecret, dataDir string, requestedDays int) error {
+	// Only the dates missing from the cache are downloaded
+	if _, err := LoadDataStore(dataDir); err != nil {
+		slog.Debug("Syncing without cached data", "dir", dataDir, "err", err)
+	}
+	store := StoreFor(dataDir)
+	downloader, err := newFitbitDownloader(clientID, clientSecret, dataDir)
+	if err != nil {
+		return err
+	}
 
 	// Check if we already have token information
 	err = downloader.LoadTokenInfo()
+	if err != nil && settings.Headless {
+		return fmt.Errorf("not authorized: %w", err)
+	}
 	if err != nil {
 		// First time authentication (only needed once)
 		// This will open your browser for authorization
-		fmt.Println("No token information found. Starting authorization flow...")
+		slog.Info("No token information found, starting authorization flow")
+		publishSync(dataDir, SyncEvent{Metric: "authorization", Status: SyncStarted})
 		err = downloader.StartAuthFlow()
 		if err != nil {
-			fmt.Println("Authorization failed:", err)
+			slog.Error("Authorization failed", "err", err)
 			return err
 		}
+		publishSync(dataDir, SyncEvent{Metric: "authorization", Status: SyncDone})
 	} else {
 		// Refresh the access token if it exists
-		fmt.Println("Refreshing access token...")
+		slog.Debug("Refreshing access token")
 		err = downloader.RefreshAccessToken()
 		if err != nil {
-			fmt.Println("Failed to refresh access token:", err)
+			slog.Error("Failed to refresh access token", "err", err)
 			return err
 		}
 	}
-	// Check data refresh timestamp
 
+	publishSync(dataDir, SyncEvent{Metric: "profile", Status: SyncStarted})
 	profileData, err := downloader.DownloadProfile()
 	if err != nil {
-		log.Fatal("Failed to download profile:", err)
+		publishSync(dataDir, SyncEvent{Metric: "profile", Status: SyncFailed, Error: err.Error()})
+		return fmt.Errorf("failed to download profile: %w", err)
 	}
+	store.mu.Lock()
 	if profileData != nil {
-		Store.ProfileData = *profileData
+		store.ProfileData = *profileData
 	}
+	if store.metricSyncedAt == nil {
+		store.metricSyncedAt = map[string]time.Time{}
+	}
+	store.metricSyncedAt["profile"] = time.Now()
+	store.mu.Unlock()
+	publishSync(dataDir, SyncEvent{Metric: "profile", Status: SyncDone})
+
+	// Goals only add goal lines and rings, the data is still worth downloading without them
+	publishSync(dataDir, SyncEvent{Metric: "goals", Status: SyncStarted})
+	goals, err := downloader.DownloadGoals()
+	if err == nil {
+		err = saveFitbitGoals(dataDir, goals)
+	}
+	if err != nil {
+		slog.Error("Failed to download goals", "dir", dataDir, "err", err)
+		publishSync(dataDir, SyncEvent{Metric: "goals", Status: SyncFailed, Error: err.Error()})
+	} else {
+		store.mu.Lock()
+		store.metricSyncedAt["goals"] = time.Now()
+		store.mu.Unlock()
+		publishSync(dataDir, SyncEvent{Metric: "goals", Status: SyncDone})
+	}
+
+	want := syncRange(requestedDays, profileData)
 
 	var wg sync.WaitGroup
-	var mu sync.Mutex
+	errChan := make(chan error, len(HistoryMetrics))
+	started := 0
 
-	errChan := make(chan error, 4) // Buffer size of 3 to hold potential errors from goroutines
+	// download fetches the missing dates of one metric in its own goroutine and reports its progress
+	download := func(metric string, fetch func(DateRange) error) {
+		store.mu.RLock()
+		chunks := store.History.missingChunks(metric, want)
+		store.mu.RUnlock()
 
-	wg.Add(4)
-	go func() {
-		defer wg.Done()
-		stepData, err := downloader.DownloadActivities("steps", requestedDays)
+		started++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			publishSync(dataDir, SyncEvent{Metric: metric, Status: SyncStarted})
+			for _, chunk := range chunks {
+				// Later chunks would leave a gap in the fetched dates
+				if err := fetch(chunk); err != nil {
+					errChan <- fmt.Errorf("failed to download %s data: %w", metric, err)
+					publishSync(dataDir, SyncEvent{Metric: metric, Status: SyncFailed, Error: err.Error()})
+					return
+				}
+			}
+			store.mu.Lock()
+			store.metricSyncedAt[metric] = time.Now()
+			store.mu.Unlock()
+			publishSync(dataDir, SyncEvent{Metric: metric, Status: SyncDone})
+		}()
+	}
+
+	for _, activity := range []string{"steps", "calories", "elevation", "floors", "distance"} {
+		download(activity, func(chunk DateRange) error {
+			data, err := downloader.DownloadActivities(activity, chunk)
+			if err != nil {
+				return err
+			}
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			store.History.mergeActivities(data)
+			store.History.markFetched(activity, chunk)
+			store.dirty = true
+			return nil
+		})
+	}
+
+	// Active minutes add up two Fitbit time series
+	download("active_minutes", func(chunk DateRange) error {
+		fairly, err := downloader.DownloadActivities("minutesFairlyActive", chunk)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to download steps data: %w", err)
-			return
+			return err
 		}
-		if stepData != nil {
-			processedData := stepData.ProcessData(strconv.Itoa(requestedDays))
-			mu.Lock()
-			Store.StepsData = processedData
-			mu.Unlock()
+		very, err := downloader.DownloadActivities("minutesVeryActive", chunk)
+		if err != nil {
+			return err
 		}
-	}()
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.History.mergeActivities(fairly)
+		store.History.mergeActivities(very)
+		store.History.markFetched("active_minutes", chunk)
+		store.dirty = true
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
-		caloriesData, err := downloader.DownloadActivities("calories", requestedDays)
+	download("heart_rate", func(chunk DateRange) error {
+		data, err := downloader.DownloadHeartRate(chunk)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to download calories data: %w", err)
-			return
-		}
-		if caloriesData != nil {
-			processedData := caloriesData.ProcessData(strconv.Itoa(requestedDays))
-			mu.Lock()
-			Store.CaloriesData = processedData
-			mu.Unlock()
+			return err
 		}
-	}()
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.History.mergeHeartRate(data)
+		store.History.markFetched("heart_rate", chunk)
+		store.dirty = true
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
-		elevationData, err := downloader.DownloadActivities("elevation", requestedDays)
+	download("sleep", func(chunk DateRange) error {
+		data, err := downloader.DownloadSleep(chunk)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to download elevation data: %w", err)
-			return
-		}
-		if elevationData != nil {
-			processedData := elevationData.ProcessData(strconv.Itoa(requestedDays))
-			mu.Lock()
-			Store.ElevationData = processedData
-			mu.Unlock()
+			return err
 		}
-	}()
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.History.mergeSleep(data, chunk)
+		store.History.markFetched("sleep", chunk)
+		store.dirty = true
+		return nil
+	})
 
-	go func() {
-		defer wg.Done()
-		heartRateData, err := downloader.DownloadHeartRate(requestedDays)
+	download("hrv", func(chunk DateRange) error {
+		data, err := downloader.DownloadHRV(chunk)
 		if err != nil {
-			errChan <- fmt.Errorf("failed to download heart rate data: %w", err)
-			return
-		}
-		if heartRateData != nil {
-			// Process and store heart rate data as needed
-			processedData := heartRateData.ProcessData(strconv.Itoa(requestedDays))
-			mu.Lock()
-			Store.HeartRateData = processedData
-			mu.Unlock()
+			return err
 		}
-	}()
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.History.mergeHRV(data)
+		store.History.markFetched("hrv", chunk)
+		store.dirty = true
+		return nil
+	})
 
 	wg.Wait()
 	close(errChan)
 
-	// Check for errors from goroutines
+	var failed []error
 	for err := range errChan {
-		log.Println(err)
+		slog.Error("Download failed", "dir", dataDir, "err", err)
+		failed = append(failed, err)
+	}
+	store.mu.Lock()
+	// A sync where every metric failed downloaded nothing, the data stays as old as it was
+	if len(failed) < started {
+		store.syncedAt = time.Now()
+	}
+	store.dirty = true
+	store.mu.Unlock()
+
+	// Records are kept apart from the cache, a failure leaves them for the next sync
+	publishSync(dataDir, SyncEvent{Metric: "records", Status: SyncStarted})
+	_, beaten, err := UpdateRecords(dataDir)
+	if err != nil {
+		slog.Error("Failed to update records", "dir", dataDir, "err", err)
+		publishSync(dataDir, SyncEvent{Metric: "records", Status: SyncFailed, Error: err.Error()})
+	} else {
+		if len(beaten) > 0 {
+			slog.Info("New personal records", "dir", dataDir, "records", beaten)
+		}
+		store.mu.Lock()
+		store.metricSyncedAt["records"] = time.Now()
+		store.mu.Unlock()
+		publishSync(dataDir, SyncEvent{Metric: "records", Status: SyncDone})
 	}
+
 	// populate data timestamp and write data to disk
-	err = cacheData(downloader)
+	err = cacheData(dataDir)
 	if err != nil {
-		log.Printf("Failed to cache data: %v", err)
+		slog.Error("Failed to cache data", "err", err)
 	}
 
-	return nil
+	// The metrics that were downloaded are kept, the failed ones are retried by the next sync
+	return errors.Join(failed...)
 }
 
-// newFitbitDownloader creates a new downloader instance
-func newFitbitDownloader(clientID, clientSecret, dataDir string) *FitbitDownloader {
-	// Create data directory if it doesn't exist
-	if _, err := os.Stat(dataDir); os.IsNotExist(err) {
-		err := os.Mkdir(dataDir, 0755)
-		if err != nil {
-			log.Fatal("Failed to create data directory:", err)
+// syncRange returns the dates a sync should cover: the last requestedDays or, when it
+// is not positive, everything since the account was created
+func syncRange(requestedDays int, profile *ProfileData) DateRange {
+	today := Today()
+	if requestedDays > 0 {
+		return DateRange{From: today.AddDate(0, 0, -requestedDays), To: today}
+	}
+	if profile != nil {
+		if since, err := time.Parse(time.DateOnly, profile.User.MemberSince); err == nil && !since.After(today) {
+			return DateRange{From: since, To: today}
 		}
 	}
+	return DateRange{From: today.AddDate(-1, 0, 0), To: today}
+}
+
+// Authorize runs the browser authorization flow for dataDir and stores the resulting token
+func Authorize(clientID, clientSecret, dataDir string) error {
+	downloader, err := newFitbitDownloader(clientID, clientSecret, dataDir)
+	if err != nil {
+		return err
+	}
+	return downloader.StartAuthFlow()
+}
+
+// newFitbitDownloader creates a new downloader instance, and the data directory when it is missing
+func newFitbitDownloader(clientID, clientSecret, dataDir string) (*FitbitDownloader, error) {
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		slog.Error("Failed to create data directory", "dir", dataDir, "err", err)
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
 
 	return &FitbitDownloader{
 		Config: Config{
 			ClientID:     clientID,
 			ClientSecret: clientSecret,
-			RedirectURI:  "http://fitbit-pi.local",
-			RedirectPort: "8080",
+			RedirectURI:  settings.RedirectURI,
+			RedirectPort: settings.RedirectPort,
 		},
 		DataDir: dataDir,
-	}
+	}, nil
 }
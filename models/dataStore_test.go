@@ -0,0 +1,21 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewFitbitDownloaderReportsDataDirErrors(t *testing.T) {
+	// A file where the parent directory should be keeps the data directory from being created
+	parent := filepath.Join(t.TempDir(), "users")
+	if err := os.WriteFile(parent, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFitbitDownloader("id", "secret", filepath.Join(parent, "alice")); err == nil {
+		t.Fatal("newFitbitDownloader succeeded without a data directory")
+	}
+	if err := SyncDataStore("id", "secret", filepath.Join(parent, "alice"), 1); err == nil {
+		t.Error("SyncDataStore succeeded without a data directory")
+	}
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Quota is the Fitbit API rate limit reported with the last response for an account
+type Quota struct {
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+	UpdatedAt time.Time
+}
+
+var (
+	quotasMu sync.Mutex
+	quotas   = map[string]Quota{} // by data directory
+)
+
+// recordQuota remembers the rate limit headers Fitbit sends with every API response
+func (fd *FitbitDownloader) recordQuota(resp *http.Response) {
+	remaining, err := strconv.Atoi(resp.Header.Get("Fitbit-Rate-Limit-Remaining"))
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.Atoi(resp.Header.Get("Fitbit-Rate-Limit-Limit"))
+	reset, _ := strconv.Atoi(resp.Header.Get("Fitbit-Rate-Limit-Reset"))
+
+	now := time.Now()
+	quotasMu.Lock()
+	defer quotasMu.Unlock()
+	quotas[fd.DataDir] = Quota{
+		Limit:     limit,
+		Remaining: remaining,
+		ResetAt:   now.Add(time.Duration(reset) * time.Second),
+		UpdatedAt: now,
+	}
+}
+
+// QuotaFor returns the last known rate limit of dataDir. It is false until the
+// process has talked to the Fitbit API for that account.
+func QuotaFor(dataDir string) (Quota, bool) {
+	quotasMu.Lock()
+	defer quotasMu.Unlock()
+	q, ok := quotas[dataDir]
+	return q, ok
+}
+
+// MetricSyncTimes returns when each metric was last downloaded. Caches written
+// before the times were tracked report their overall timestamp for every metric.
+func (c *CacheData) MetricSyncTimes() map[string]time.Time {
+	if len(c.MetricSyncedAt) > 0 {
+		return c.MetricSyncedAt
+	}
+	synced := time.Unix(c.Timestamp, 0)
+	return map[string]time.Time{
+		"profile":    synced,
+		"steps":      synced,
+		"calories":   synced,
+		"elevation":  synced,
+		"heart_rate": synced,
+	}
+}
+
+// DirSize returns the total size in bytes of the files below dir
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// ExportRow is one day of the history
+type ExportRow struct {
+	Date             string         `json:"date"`
+	Steps            int            `json:"steps"`
+	Calories         int            `json:"calories"`
+	Elevation        int            `json:"elevation"`
+	Floors           int            `json:"floors"`
+	ActiveMinutes    int            `json:"active_minutes"`
+	RestingHeartRate int            `json:"resting_heart_rate"`
+	ZoneMinutes      map[string]int `json:"zone_minutes"`
+	SleepMinutes     int            `json:"sleep_minutes"`
+	HRV              int            `json:"hrv"`
+}
+
+// HeartRateZones lists the Fitbit heart rate zones from lowest to highest
+var HeartRateZones = []string{"Out of Range", "Fat Burn", "Cardio", "Peak"}
+
+// firstSeries returns the only series of a single-metric chart
+func firstSeries(data ChartData) []int {
+	for _, values := range data.Series {
+		return values
+	}
+	return nil
+}
+
+// ExportRows returns every day of the history in date order
+func (h *History) ExportRows() []ExportRow {
+	dates := h.Dates()
+	rows := make([]ExportRow, len(dates))
+	for i, date := range dates {
+		day := h.Days[date]
+		rows[i] = ExportRow{
+			Date:             date,
+			Steps:            day.Steps,
+			Calories:         day.Calories,
+			Elevation:        day.Elevation,
+			Floors:           day.Floors,
+			ActiveMinutes:    day.FairlyActiveMinutes + day.VeryActiveMinutes,
+			RestingHeartRate: day.RestingHeartRate,
+			ZoneMinutes:      day.ZoneMinutes,
+			SleepMinutes:     day.SleepMinutes,
+			HRV:              day.HRV,
+		}
+	}
+	return rows
+}
+
+// WriteCSV writes rows as CSV with a header line
+func WriteCSV(w io.Writer, rows []ExportRow) error {
+	cw := csv.NewWriter(w)
+	header := []string{"date", "steps", "calories", "elevation", "floors", "active_minutes", "resting_heart_rate"}
+	for _, zone := range HeartRateZones {
+		header = append(header, zone+" minutes")
+	}
+	header = append(header, "sleep_minutes", "hrv")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		record := []string{
+			row.Date,
+			strconv.Itoa(row.Steps),
+			strconv.Itoa(row.Calories),
+			strconv.Itoa(row.Elevation),
+			strconv.Itoa(row.Floors),
+			strconv.Itoa(row.ActiveMinutes),
+			strconv.Itoa(row.RestingHeartRate),
+		}
+		for _, zone := range HeartRateZones {
+			record = append(record, strconv.Itoa(row.ZoneMinutes[zone]))
+		}
+		record = append(record, strconv.Itoa(row.SleepMinutes), strconv.Itoa(row.HRV))
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes rows as an indented JSON array
+func WriteJSON(w io.Writer, rows []ExportRow) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
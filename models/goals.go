@@ -0,0 +1,213 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// GoalMetrics are the daily metrics Fitbit keeps goals for, in display order
+var GoalMetrics = []string{"steps", "floors", "calories", "active_minutes"}
+
+// Goals are daily targets by metric name
+type Goals map[string]int
+
+// GoalFile is the goals.json of a data directory: the daily goals set at Fitbit and
+// local overrides, which take precedence
+type GoalFile struct {
+	Fitbit    Goals     `json:"fitbit"`
+	Overrides Goals     `json:"overrides,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Effective returns the goals in use, the overrides replacing the Fitbit goals
+func (g GoalFile) Effective() Goals {
+	goals := Goals{}
+	for metric, goal := range g.Fitbit {
+		goals[metric] = goal
+	}
+	for metric, goal := range g.Overrides {
+		goals[metric] = goal
+	}
+	return goals
+}
+
+// goalsMu serializes the updates of goals.json by syncs and the goals page
+var goalsMu sync.Mutex
+
+// LoadGoals reads the goals of dataDir, empty before the first sync
+func LoadGoals(dataDir string) (GoalFile, error) {
+	var goals GoalFile
+	data, err := os.ReadFile(filepath.Join(dataDir, "goals.json"))
+	if os.IsNotExist(err) {
+		return goals, nil
+	}
+	if err != nil {
+		return goals, fmt.Errorf("failed to read goals: %w", err)
+	}
+	if err := json.Unmarshal(data, &goals); err != nil {
+		return goals, fmt.Errorf("failed to parse goals: %w", err)
+	}
+	return goals, nil
+}
+
+// updateGoals changes goals.json of dataDir with update
+func updateGoals(dataDir string, update func(*GoalFile)) error {
+	goalsMu.Lock()
+	defer goalsMu.Unlock()
+
+	goals, err := LoadGoals(dataDir)
+	if err != nil {
+		return err
+	}
+	update(&goals)
+	data, err := json.MarshalIndent(goals, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal goals: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dataDir, "goals.json"), data, 0644)
+}
+
+// saveFitbitGoals stores the goals downloaded from Fitbit, keeping the overrides
+func saveFitbitGoals(dataDir string, goals Goals) error {
+	return updateGoals(dataDir, func(g *GoalFile) {
+		g.Fitbit = goals
+		g.UpdatedAt = time.Now()
+	})
+}
+
+// SaveGoalOverrides replaces the local goals of dataDir, metrics left out follow Fitbit again
+func SaveGoalOverrides(dataDir string, overrides Goals) error {
+	return updateGoals(dataDir, func(g *GoalFile) {
+		g.Overrides = overrides
+	})
+}
+
+// DownloadGoals downloads the daily activity goals
+func (fd *FitbitDownloader) DownloadGoals() (Goals, error) {
+	slog.Info("Downloading activity goals")
+	url := "https://api.fitbit.com/1/user/-/activities/goals/daily.json"
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create goals request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+fd.TokenInfo.AccessToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("goals request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	fd.recordQuota(resp)
+
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to download goals: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var body struct {
+		Goals struct {
+			ActiveMinutes float64 `json:"activeMinutes"`
+			CaloriesOut   float64 `json:"caloriesOut"`
+			Floors        float64 `json:"floors"`
+			Steps         float64 `json:"steps"`
+		} `json:"goals"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to parse goals JSON: %v", err)
+	}
+
+	goals := Goals{}
+	for metric, value := range map[string]float64{
+		"steps":          body.Goals.Steps,
+		"floors":         body.Goals.Floors,
+		"calories":       body.Goals.CaloriesOut,
+		"active_minutes": body.Goals.ActiveMinutes,
+	} {
+		// Metrics without a goal are left out
+		if value > 0 {
+			goals[metric] = int(math.Round(value))
+		}
+	}
+	return goals, nil
+}
+
+// Streak counts the days in a row a goal was met
+type Streak struct {
+	// Current ends today, or yesterday while today's goal is not met yet
+	Current int
+	Longest int
+}
+
+// Streak returns the streaks of m meeting goal up to today
+func (h *History) Streak(m DailyMetric, goal int, today time.Time) Streak {
+	var s Streak
+	fetched, ok := h.Fetched[m.Source]
+	if !ok || goal <= 0 {
+		return s
+	}
+
+	run := 0
+	for date := fetched.From; !date.After(fetched.To) && !date.After(today); date = date.AddDate(0, 0, 1) {
+		if m.Value(h.Days[date.Format(time.DateOnly)]) >= goal {
+			run++
+			s.Longest = max(s.Longest, run)
+		} else if !date.Equal(today) {
+			// An unmet today does not break the streak, the day is not over
+			run = 0
+		}
+	}
+	s.Current = run
+	// Without data for yesterday nothing is known about the current streak
+	if fetched.To.Before(today.AddDate(0, 0, -1)) {
+		s.Current = 0
+	}
+	return s
+}
+
+// GoalProgress is how far a goal is reached today
+type GoalProgress struct {
+	Metric DailyMetric
+	Goal   int
+	Today  int
+	Streak Streak
+}
+
+// Percent returns the share of the goal reached, capped at 100
+func (p GoalProgress) Percent() int {
+	if p.Goal <= 0 {
+		return 0
+	}
+	return min(100, p.Today*100/p.Goal)
+}
+
+// GoalProgress returns today's progress towards every goal set in goals
+func (s *DataStore) GoalProgress(goals Goals) []GoalProgress {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	today := Today()
+	var progress []GoalProgress
+	for _, name := range GoalMetrics {
+		goal, ok := goals[name]
+		m, found := LookupMetric(name)
+		if !ok || !found {
+			continue
+		}
+		progress = append(progress, GoalProgress{
+			Metric: m,
+			Goal:   goal,
+			Today:  m.Value(s.History.Days[today.Format(time.DateOnly)]),
+			Streak: s.History.Streak(m, goal, today),
+		})
+	}
+	return progress
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DayRecord holds the daily totals of one day
+type DayRecord struct {
+	Steps               int            `json:"steps,omitempty"`
+	Calories            int            `json:"calories,omitempty"`
+	Elevation           int            `json:"elevation,omitempty"`
+	Floors              int            `json:"floors,omitempty"`
+	FairlyActiveMinutes int            `json:"fairly_active_minutes,omitempty"`
+	VeryActiveMinutes   int            `json:"very_active_minutes,omitempty"`
+	RestingHeartRate    int            `json:"resting_heart_rate,omitempty"`
+	ZoneMinutes         map[string]int `json:"zone_minutes,omitempty"`
+	SleepMinutes        int            `json:"sleep_minutes,omitempty"`
+	HRV                 int            `json:"hrv,omitempty"` // daily RMSSD in ms
+	DistanceMeters      int            `json:"distance_meters,omitempty"`
+}
+
+// History is the daily data of an account, keyed by date (2006-01-02)
+type History struct {
+	Days map[string]DayRecord `json:"days"`
+	// Fetched holds the dates downloaded so far for each metric
+	Fetched map[string]DateRange `json:"fetched"`
+}
+
+// HistoryMetrics are the metrics kept in the history, in download order
+var HistoryMetrics = []string{"steps", "calories", "elevation", "floors", "distance", "active_minutes", "heart_rate", "sleep", "hrv"}
+
+// metricMaxSpan is the longest date range in days Fitbit answers in one request
+var metricMaxSpan = map[string]int{
+	"steps":          1095,
+	"calories":       1095,
+	"elevation":      1095,
+	"floors":         1095,
+	"distance":       1095,
+	"active_minutes": 1095,
+	"heart_rate":     365,
+	"sleep":          100,
+	"hrv":            30,
+}
+
+// Has reports whether metric was downloaded for date
+func (h *History) Has(metric string, date time.Time) bool {
+	fetched, ok := h.Fetched[metric]
+	return ok && fetched.Contains(date)
+}
+
+// Earliest returns the first date of any metric, the zero time for an empty history
+func (h *History) Earliest() time.Time {
+	var earliest time.Time
+	for _, fetched := range h.Fetched {
+		if earliest.IsZero() || fetched.From.Before(earliest) {
+			earliest = fetched.From
+		}
+	}
+	return earliest
+}
+
+// Dates returns the dates of the history in order
+func (h *History) Dates() []string {
+	dates := make([]string, 0, len(h.Days))
+	for date := range h.Days {
+		dates = append(dates, date)
+	}
+	slices.Sort(dates)
+	return dates
+}
+
+// clone returns a deep enough copy of h to merge downloads into while h is read
+func (h *History) clone() History {
+	c := History{
+		Days:    make(map[string]DayRecord, len(h.Days)),
+		Fetched: make(map[string]DateRange, len(h.Fetched)),
+	}
+	for date, day := range h.Days {
+		c.Days[date] = day
+	}
+	for metric, fetched := range h.Fetched {
+		c.Fetched[metric] = fetched
+	}
+	return c
+}
+
+// update changes the record of date in place
+func (h *History) update(date time.Time, set func(*DayRecord)) {
+	if h.Days == nil {
+		h.Days = map[string]DayRecord{}
+	}
+	key := date.Format(time.DateOnly)
+	day := h.Days[key]
+	set(&day)
+	h.Days[key] = day
+}
+
+// markFetched extends the fetched dates of metric by r
+func (h *History) markFetched(metric string, r DateRange) {
+	if h.Fetched == nil {
+		h.Fetched = map[string]DateRange{}
+	}
+	fetched, ok := h.Fetched[metric]
+	if !ok {
+		h.Fetched[metric] = r
+		return
+	}
+	if r.From.Before(fetched.From) {
+		fetched.From = r.From
+	}
+	if r.To.After(fetched.To) {
+		fetched.To = r.To
+	}
+	h.Fetched[metric] = fetched
+}
+
+// missingChunks returns the requests needed to download metric for want. The last fetched
+// day is downloaded again as it may have been synced before the day was over. Chunks
+// are ordered so each one borders the dates fetched before it: older data is filled in
+// backwards from the fetched dates, newer data forwards.
+func (h *History) missingChunks(metric string, want DateRange) []DateRange {
+	span := metricMaxSpan[metric]
+	fetched, ok := h.Fetched[metric]
+	if !ok {
+		return chunksBackward(want, span)
+	}
+
+	var chunks []DateRange
+	if !want.To.Before(fetched.To) {
+		chunks = append(chunks, chunksForward(DateRange{From: fetched.To, To: want.To}, span)...)
+	}
+	if want.From.Before(fetched.From) {
+		older := DateRange{From: want.From, To: fetched.From.AddDate(0, 0, -1)}
+		chunks = append(chunks, chunksBackward(older, span)...)
+	}
+	return chunks
+}
+
+func chunksForward(r DateRange, span int) []DateRange {
+	var chunks []DateRange
+	for from := r.From; !from.After(r.To); from = from.AddDate(0, 0, span) {
+		to := from.AddDate(0, 0, span-1)
+		if to.After(r.To) {
+			to = r.To
+		}
+		chunks = append(chunks, DateRange{From: from, To: to})
+	}
+	return chunks
+}
+
+func chunksBackward(r DateRange, span int) []DateRange {
+	var chunks []DateRange
+	for to := r.To; !to.Before(r.From); to = to.AddDate(0, 0, -span) {
+		from := to.AddDate(0, 0, -(span - 1))
+		if from.Before(r.From) {
+			from = r.From
+		}
+		chunks = append(chunks, DateRange{From: from, To: to})
+	}
+	return chunks
+}
+
+// mergeActivities stores the downloaded values of an activity time series
+func (h *History) mergeActivities(data *ActivityData) {
+	for _, entry := range data.Activities {
+		date, err := time.Parse(time.DateOnly, entry.DateTime)
+		if err != nil {
+			continue
+		}
+		// Elevation comes with decimals
+		value, err := strconv.ParseFloat(entry.Value, 64)
+		if err != nil {
+			value = 0
+		}
+		rounded := int(math.Round(value))
+		// Distances are in kilometers
+		meters := int(math.Round(value * 1000))
+		h.update(date, func(day *DayRecord) {
+			switch data.ActivityType {
+			case "steps":
+				day.Steps = rounded
+			case "calories":
+				day.Calories = rounded
+			case "elevation":
+				day.Elevation = rounded
+			case "floors":
+				day.Floors = rounded
+			case "distance":
+				day.DistanceMeters = meters
+			case "minutesFairlyActive":
+				day.FairlyActiveMinutes = rounded
+			case "minutesVeryActive":
+				day.VeryActiveMinutes = rounded
+			}
+		})
+	}
+}
+
+// mergeHeartRate stores the downloaded resting heart rates and zone minutes
+func (h *History) mergeHeartRate(data *ActivitiesHeartList) {
+	for _, entry := range data.ActivitiesHeart {
+		date, err := time.Parse(time.DateOnly, entry.DateTime)
+		if err != nil {
+			continue
+		}
+		zones := make(map[string]int, len(entry.Value.HeartRateZones))
+		for _, zone := range entry.Value.HeartRateZones {
+			zones[zone.Name] = zone.Minutes
+		}
+		h.update(date, func(day *DayRecord) {
+			day.RestingHeartRate = entry.Value.RestingHeartRate
+			day.ZoneMinutes = zones
+		})
+	}
+}
+
+// historyFromLegacy rebuilds the history from a cache written before the history was kept.
+// Those caches held chart data, heart rate labels lack the year which is taken from ref.
+func historyFromLegacy(c *CacheData, ref time.Time) History {
+	var h History
+	activities := map[string]*ChartData{"steps": c.Steps, "calories": c.Calories, "elevation": c.Elevation}
+	for metric, data := range activities {
+		if data == nil {
+			continue
+		}
+		values := firstSeries(*data)
+		for i, label := range data.XAxis {
+			date, ok := legacyDate(label, ref)
+			if !ok || i >= len(values) {
+				continue
+			}
+			value := values[i]
+			h.update(date, func(day *DayRecord) {
+				switch metric {
+				case "steps":
+					day.Steps = value
+				case "calories":
+					day.Calories = value
+				case "elevation":
+					day.Elevation = value
+				}
+			})
+			h.markFetched(metric, DateRange{From: date, To: date})
+		}
+	}
+	if c.HeartRate != nil {
+		entries := c.HeartRate.Series["Heart Rate"]
+		for i, label := range c.HeartRate.XAxis {
+			date, ok := legacyDate(label, ref)
+			if !ok || i >= len(entries) {
+				continue
+			}
+			entry := entries[i]
+			h.update(date, func(day *DayRecord) {
+				day.RestingHeartRate = entry.RestingRate
+				day.ZoneMinutes = entry.Zones
+			})
+			h.markFetched("heart_rate", DateRange{From: date, To: date})
+		}
+	}
+	return h
+}
+
+// legacyDate parses the x axis labels of old caches, "2006-01-02" or "Mon 01-02"
+func legacyDate(label string, ref time.Time) (time.Time, bool) {
+	if date, err := time.Parse(time.DateOnly, label); err == nil {
+		return date, true
+	}
+	_, monthDay, found := strings.Cut(label, " ")
+	if !found {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(time.DateOnly, strconv.Itoa(ref.Year())+"-"+monthDay)
+	if err != nil {
+		return time.Time{}, false
+	}
+	// Labels from late December in a cache written in January belong to the year before
+	if date.After(civilDate(ref)) {
+		date = date.AddDate(-1, 0, 0)
+	}
+	return date, true
+}
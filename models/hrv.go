@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+)
+
+// HRVList is the answer of the heart rate variability range endpoint
+type HRVList struct {
+	HRV []struct {
+		DateTime string `json:"dateTime"`
+		Value    struct {
+			DailyRmssd float64 `json:"dailyRmssd"`
+			DeepRmssd  float64 `json:"deepRmssd"`
+		} `json:"value"`
+	} `json:"hrv"`
+}
+
+// DownloadHRV downloads the daily heart rate variability of r, measured during sleep
+func (fd *FitbitDownloader) DownloadHRV(r DateRange) (*HRVList, error) {
+	startDate := r.From.Format(time.DateOnly)
+	endDate := r.To.Format(time.DateOnly)
+	slog.Info("Downloading heart rate variability", "from", startDate, "to", endDate)
+
+	endpoint := fmt.Sprintf("https://api.fitbit.com/1/user/-/hrv/date/%s/%s.json", startDate, endDate)
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %v", endpoint, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+fd.TokenInfo.AccessToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request for %s failed: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	fd.recordQuota(resp)
+
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to download heart rate variability: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var data HRVList
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse heart rate variability JSON: %v", err)
+	}
+	slog.Debug("Heart rate variability downloaded", "days", len(data.HRV))
+	return &data, nil
+}
+
+// mergeHRV stores the daily RMSSD in milliseconds, rounded
+func (h *History) mergeHRV(data *HRVList) {
+	for _, entry := range data.HRV {
+		date, err := time.Parse(time.DateOnly, entry.DateTime)
+		if err != nil {
+			continue
+		}
+		h.update(date, func(day *DayRecord) {
+			day.HRV = int(math.Round(entry.Value.DailyRmssd))
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// zoneWeights weigh the minutes of each heart rate zone in the training load, after the
+// zone weights of Edwards' TRIMP. Out of range minutes are not training.
+var zoneWeights = map[string]float64{
+	"Fat Burn": 1,
+	"Cardio":   3,
+	"Peak":     5,
+}
+
+const (
+	// acuteDays and chronicDays are the time constants of fatigue and fitness
+	acuteDays   = 7
+	chronicDays = 42
+	// overreachingRatio is the acute:chronic ratio above which injury and illness risk rises
+	overreachingRatio = 1.5
+)
+
+// trainingLoad scores the training of a day from its zone minutes
+func trainingLoad(day DayRecord) int {
+	var load float64
+	for zone, weight := range zoneWeights {
+		load += weight * float64(day.ZoneMinutes[zone])
+	}
+	return int(math.Round(load))
+}
+
+// TrainingDay is the fitness and fatigue model on one day
+type TrainingDay struct {
+	Date time.Time
+	Load int
+	// Acute (fatigue) and Chronic (fitness) are exponentially weighted averages of the
+	// load over acuteDays and chronicDays
+	Acute   float64
+	Chronic float64
+	// Form is the fitness of the day before minus its fatigue, negative while training hard
+	Form float64
+	// Ratio is Acute / Chronic, 0 without any chronic load
+	Ratio float64
+}
+
+// TrainingLoad runs the fitness and fatigue model over the whole heart rate history and
+// returns the days of r. Days without heart rate data count as rest days.
+func (h *History) TrainingLoad(r DateRange) []TrainingDay {
+	fetched, ok := h.Fetched["heart_rate"]
+	if !ok {
+		return nil
+	}
+	var days []TrainingDay
+	var acute, chronic float64
+	for date := fetched.From; !date.After(r.To) && !date.After(fetched.To); date = date.AddDate(0, 0, 1) {
+		load := trainingLoad(h.Days[date.Format(time.DateOnly)])
+		form := chronic - acute
+		acute += (float64(load) - acute) / acuteDays
+		chronic += (float64(load) - chronic) / chronicDays
+		if date.Before(r.From) {
+			continue
+		}
+		day := TrainingDay{Date: date, Load: load, Acute: acute, Chronic: chronic, Form: form}
+		if chronic > 0 {
+			day.Ratio = acute / chronic
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// TrainingLoadData is the fitness, fatigue and form chart
+type TrainingLoadData struct {
+	Title    string
+	Subtitle string
+	XAxis    []string
+	Load     []int
+	Fitness  []float64
+	Fatigue  []float64
+	Form     []float64
+	Ratio    []float64
+}
+
+// TrainingLoadChart draws the fitness and fatigue model over r, one point per day
+func (h *History) TrainingLoadChart(r DateRange) TrainingLoadData {
+	days := h.TrainingLoad(r)
+	chart := TrainingLoadData{Title: "Training Load", Subtitle: "Daily load from heart rate zone minutes"}
+	for _, d := range days {
+		chart.XAxis = append(chart.XAxis, Daily.label(d.Date, r))
+		chart.Load = append(chart.Load, d.Load)
+		chart.Fitness = append(chart.Fitness, round1(d.Chronic))
+		chart.Fatigue = append(chart.Fatigue, round1(d.Acute))
+		chart.Form = append(chart.Form, round1(d.Form))
+		chart.Ratio = append(chart.Ratio, math.Round(d.Ratio*100)/100)
+	}
+	if len(days) > 0 {
+		last := days[len(days)-1]
+		chart.Subtitle = fmt.Sprintf("Acute:chronic ratio %.2f on %s", last.Ratio, last.Date.Format("Jan 2"))
+		if last.Ratio > overreachingRatio {
+			chart.Subtitle += fmt.Sprintf(", above %.1f: risk of overreaching", overreachingRatio)
+		}
+	}
+	return chart
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidLogin is returned when a username or password does not match
+var ErrInvalidLogin = errors.New("invalid username or password")
+
+// ErrLoginExists is returned when the first dashboard account is created a second time
+var ErrLoginExists = errors.New("a dashboard login already exists")
+
+// Login is a local dashboard account, unrelated to the linked Fitbit accounts
+type Login struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// minPasswordLength is the shortest password accepted for a dashboard account
+const minPasswordLength = 8
+
+var loginsMu sync.Mutex
+
+// dummyHash is compared against when a username is unknown
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("gofit"), bcrypt.DefaultCost)
+	return hash
+})
+
+func loginsFile(baseDir string) string {
+	return filepath.Join(baseDir, "logins.json")
+}
+
+func loadLogins(baseDir string) ([]Login, error) {
+	data, err := os.ReadFile(loginsFile(baseDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logins: %w", err)
+	}
+
+	var logins []Login
+	err = json.Unmarshal(data, &logins)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse logins: %w", err)
+	}
+	return logins, nil
+}
+
+// HasLogins reports whether at least one dashboard account exists
+func HasLogins(baseDir string) (bool, error) {
+	loginsMu.Lock()
+	defer loginsMu.Unlock()
+
+	logins, err := loadLogins(baseDir)
+	return len(logins) > 0, err
+}
+
+// CreateLogin creates the first dashboard account with a bcrypt hashed password. It fails
+// with ErrLoginExists once any account exists, checked under the same lock as the write.
+func CreateLogin(baseDir, username, password string) error {
+	if !ValidUserName(username) {
+		return fmt.Errorf("invalid username %q", username)
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	loginsMu.Lock()
+	defer loginsMu.Unlock()
+
+	logins, err := loadLogins(baseDir)
+	if err != nil {
+		return err
+	}
+	if len(logins) > 0 {
+		return ErrLoginExists
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	logins = append(logins, Login{
+		Username:     username,
+		PasswordHash: string(hash),
+		CreatedAt:    time.Now(),
+	})
+
+	data, err := json.MarshalIndent(logins, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal logins: %w", err)
+	}
+	err = os.MkdirAll(baseDir, 0755)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(loginsFile(baseDir), data, 0600)
+}
+
+// VerifyLogin checks a username and password against the stored hashes
+func VerifyLogin(baseDir, username, password string) error {
+	loginsMu.Lock()
+	logins, err := loadLogins(baseDir)
+	loginsMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, login := range logins {
+		if login.Username == username {
+			if bcrypt.CompareHashAndPassword([]byte(login.PasswordHash), []byte(password)) != nil {
+				return ErrInvalidLogin
+			}
+			return nil
+		}
+	}
+
+	// Hash anyway so unknown usernames take as long as wrong passwords
+	bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+	return ErrInvalidLogin
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// DailyMetric is one daily value that can be read from the history
+type DailyMetric struct {
+	Name  string
+	Label string
+	Unit  string
+	// Source is the download that fills the metric, see HistoryMetrics
+	Source string
+	Value  func(DayRecord) int
+	// Rate marks values such as heart rates that are averaged, never summed, and
+	// where zero means there was no reading
+	Rate bool
+}
+
+// DailyMetrics lists the metrics the analyses of the dashboard cover
+var DailyMetrics = []DailyMetric{
+	{Name: "steps", Label: "Steps", Unit: "steps", Source: "steps", Value: activityValue("steps")},
+	{Name: "calories", Label: "Calories", Unit: "kcal", Source: "calories", Value: activityValue("calories")},
+	{Name: "elevation", Label: "Elevation", Unit: "m", Source: "elevation", Value: activityValue("elevation")},
+	{Name: "floors", Label: "Floors", Unit: "floors", Source: "floors", Value: activityValue("floors")},
+	{Name: "active_minutes", Label: "Active minutes", Unit: "min", Source: "active_minutes", Value: activityValue("active_minutes")},
+	{Name: "zone_minutes", Label: "Heart zone minutes", Unit: "min", Source: "heart_rate", Value: func(day DayRecord) int {
+		return day.ZoneMinutes["Fat Burn"] + day.ZoneMinutes["Cardio"] + day.ZoneMinutes["Peak"]
+	}},
+	{Name: "training_load", Label: "Training load", Unit: "TRIMP", Source: "heart_rate", Value: trainingLoad},
+	{Name: "resting_heart_rate", Label: "Resting heart rate", Unit: "bpm", Source: "heart_rate", Rate: true, Value: func(day DayRecord) int {
+		return day.RestingHeartRate
+	}},
+	{Name: "sleep", Label: "Sleep duration", Unit: "min", Source: "sleep", Rate: true, Value: func(day DayRecord) int {
+		return day.SleepMinutes
+	}},
+	{Name: "hrv", Label: "Heart rate variability", Unit: "ms", Source: "hrv", Rate: true, Value: func(day DayRecord) int {
+		return day.HRV
+	}},
+}
+
+// LookupMetric returns the daily metric called name
+func LookupMetric(name string) (DailyMetric, bool) {
+	for _, m := range DailyMetrics {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return DailyMetric{}, false
+}
+
+// aggregation returns agg, or the mean when m cannot be summed
+func (m DailyMetric) aggregation(agg Aggregation) Aggregation {
+	if m.Rate && agg == Sum {
+		return Mean
+	}
+	return agg
+}
+
+// dailyValue is the value of a metric on one day
+type dailyValue struct {
+	Date  time.Time
+	Value int
+}
+
+// daily returns the metric for every day of r it was downloaded, skipping missing readings
+func (h *History) daily(m DailyMetric, r DateRange) []dailyValue {
+	var days []dailyValue
+	for date := r.From; !date.After(r.To); date = date.AddDate(0, 0, 1) {
+		if !h.Has(m.Source, date) {
+			continue
+		}
+		v := m.Value(h.Days[date.Format(time.DateOnly)])
+		if m.Rate && v == 0 {
+			continue
+		}
+		days = append(days, dailyValue{date, v})
+	}
+	return days
+}
+
+// values returns the values of daily
+func (h *History) values(m DailyMetric, r DateRange) []int {
+	days := h.daily(m, r)
+	values := make([]int, len(days))
+	for i, d := range days {
+		values[i] = d.Value
+	}
+	return values
+}
@@ -3,9 +3,10 @@ package models
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -13,13 +14,25 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+)
 
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
+// authFlows holds the data directories with an authorization flow under way
+var (
+	authFlowsMu sync.Mutex
+	authFlows   = map[string]bool{}
 )
 
-var AuthFlowInProgress bool
+// ErrAuthInProgress is returned when the account already has an authorization flow under way
+var ErrAuthInProgress = errors.New("authorization already in progress")
+
+// authFlowTimeout is how long the authorization flow waits for the browser, a sync waiting
+// on it blocks every later sync of the account
+const authFlowTimeout = 10 * time.Minute
+
+// ErrAuthTimeout is returned when nobody completed the authorization flow in time
+var ErrAuthTimeout = errors.New("authorization required, the browser flow was not completed in time")
 
 // Config holds the application configuration
 type Config struct {
@@ -65,6 +78,7 @@ type UserProfile struct {
 	FirstName         string  `json:"firstName"`
 	FullName          string  `json:"fullName"`
 	LastName          string  `json:"lastName"`
+	MemberSince       string  `json:"memberSince"`
 	Gender            string  `json:"gender"`
 	Height            float64 `json:"height"`
 	HeightUnit        string  `json:"heightUnit"`
@@ -107,13 +121,17 @@ type ActivitiesHeartList struct {
 }
 
 type CacheData struct {
-	MaxDays   int            `json:"max_days"`
-	Timestamp int64          `json:"timestamp"`
-	Steps     ChartData      `json:"steps"`
-	Calories  ChartData      `json:"calories"`
-	Elevation ChartData      `json:"elevation"`
-	HeartRate HeartChartData `json:"heart_rate"`
-	Profile   ProfileData    `json:"profile"`
+	Timestamp int64       `json:"timestamp"`
+	Profile   ProfileData `json:"profile"`
+	History   History     `json:"history"`
+	// MetricSyncedAt holds when each metric was last downloaded successfully
+	MetricSyncedAt map[string]time.Time `json:"metric_synced_at,omitempty"`
+
+	// Caches written before the history was kept hold chart data of the last days instead
+	Steps     *ChartData      `json:"steps,omitempty"`
+	Calories  *ChartData      `json:"calories,omitempty"`
+	Elevation *ChartData      `json:"elevation,omitempty"`
+	HeartRate *HeartChartData `json:"heart_rate,omitempty"`
 }
 
 type RateLimitError struct {
@@ -141,87 +159,33 @@ func (a *ActivityData) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (s *ActivityData) ProcessData(days_back string) ChartData {
-	// Convert StepsData to ChartData for visualization
-	tag := language.Make(s.ActivityType)
-	series := cases.Title(tag).String(s.ActivityType)
-	chart := ChartData{
-		Type:     s.ActivityType,
-		Title:    fmt.Sprintf("%s Over Time", cases.Title(language.English).String(s.ActivityType)),
-		Subtitle: fmt.Sprintf("Daily %s count", s.ActivityType),
-		XAxis:    make([]string, len(s.Activities)),
-		Series:   map[string][]int{series: make([]int, len(s.Activities))},
-	}
-
-	for i, entry := range s.Activities {
-		val, err := strconv.Atoi(entry.Value)
-		if err != nil {
-			val = 0
-		}
-		t, err := time.Parse("01-02", entry.DateTime)
-		if err != nil {
-			chart.XAxis[i] = entry.DateTime // Fallback to raw date if parsing fails
-		} else {
-			chart.XAxis[i] = t.Weekday().String()[:3] + " " + t.Format("01-02")
-		}
-
-		chart.Series[series][i] = val
-	}
-
-	return chart
-}
-
-func (s *ActivitiesHeartList) ProcessData(days_back string) HeartChartData {
-	chart := HeartChartData{
-		Title:  "Heart Rate Over Time",
-		XAxis:  make([]string, len(s.ActivitiesHeart)),
-		Series: make(map[string][]HeartRateEntry),
-	}
-
-	chart.Series["Heart Rate"] = make([]HeartRateEntry, len(s.ActivitiesHeart))
-
-	for i, entry := range s.ActivitiesHeart {
-		t, err := time.Parse("2006-01-02", entry.DateTime)
-		if err != nil {
-			chart.XAxis[i] = entry.DateTime // Fallback to raw date if parsing fails
-		} else {
-			chart.XAxis[i] = t.Weekday().String()[:3] + " " + t.Format("01-02")
-		}
-		// Create heart rate entry with zones map
-		heartRateEntry := HeartRateEntry{
-			Zones:       make(map[string]int),
-			RestingRate: entry.Value.RestingHeartRate,
-		}
-
-		// Add minutes for each zone
-		for _, zone := range entry.Value.HeartRateZones {
-			heartRateEntry.Zones[zone.Name] = zone.Minutes
-		}
-
-		chart.Series["Heart Rate"][i] = heartRateEntry
-
-	}
-	return chart
-}
-
 // StartAuthFlow initiates the OAuth authorization flow
 func (fd *FitbitDownloader) StartAuthFlow() error {
-	if AuthFlowInProgress {
-		fmt.Println("Authorization flow is already in progress. Skipping...")
-		return nil
+	dir := filepath.Clean(fd.DataDir)
+	authFlowsMu.Lock()
+	if authFlows[dir] {
+		authFlowsMu.Unlock()
+		slog.Info("Authorization flow is already in progress", "dir", dir)
+		return ErrAuthInProgress
 	}
-	AuthFlowInProgress = true // Set the flag
+	authFlows[dir] = true
+	authFlowsMu.Unlock()
 
 	defer func() {
-		AuthFlowInProgress = false // Reset the flag after completion
+		authFlowsMu.Lock()
+		delete(authFlows, dir)
+		authFlowsMu.Unlock()
 	}()
 
-	// Create a channel to receive the authorization code
-	authCodeChan := make(chan string)
-	serverErrChan := make(chan error)
+	// Create a channel to receive the authorization code, buffered so the callback
+	// server does not block once the wait timed out
+	authCodeChan := make(chan string, 1)
+	serverErrChan := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
 
 	// Start the local server to handle the callback
-	go fd.startCallbackServer(authCodeChan, serverErrChan)
+	go fd.startCallbackServer(authCodeChan, serverErrChan, stop)
 
 	// Generate authorization URL
 	authURL := "https://www.fitbit.com/oauth2/authorize"
@@ -251,10 +215,10 @@ func (fd *FitbitDownloader) StartAuthFlow() error {
 
 	// Open the authorization URL in the browser
 	cmd := exec.Command("chromium", fullAuthURL) // Use xdg-open for Linux, or change to "open" for macOS
-	fmt.Println("If no browser opens, please copy and paste the following URL into your browser:")
-	fmt.Println(fullAuthURL)
+	slog.Info("If no browser opens, please copy and paste the URL into your browser", "url", fullAuthURL)
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to open browser: %v", err)
+		// Headless machines have no browser, the printed URL can be opened elsewhere
+		slog.Warn("Failed to open browser", "err", err)
 	}
 
 	// Wait for the authorization code or an error
@@ -263,22 +227,26 @@ func (fd *FitbitDownloader) StartAuthFlow() error {
 		return fd.getAccessToken(authCode)
 	case err := <-serverErrChan:
 		return fmt.Errorf("server error: %v", err)
+	case <-time.After(authFlowTimeout):
+		slog.Warn("Authorization flow timed out", "after", authFlowTimeout)
+		return ErrAuthTimeout
 	}
 }
 
-// startCallbackServer starts a local server to receive the OAuth callback
-func (fd *FitbitDownloader) startCallbackServer(authCodeChan chan<- string, errChan chan<- error) {
+// startCallbackServer starts a local server to receive the OAuth callback, it closes
+// when stop is closed
+func (fd *FitbitDownloader) startCallbackServer(authCodeChan chan<- string, errChan chan<- error, stop <-chan struct{}) {
 	if fd.callbackRunning {
-		log.Println("Callback server is already running, skipping start.")
+		slog.Info("Callback server is already running, skipping start")
 		return
 	}
 	fd.callbackRunning = true
 
-	log.Println("Starting local server to receive authorization callback...")
+	slog.Info("Starting local server to receive authorization callback", "port", fd.Config.RedirectPort)
 
 	mux := http.NewServeMux()
 	server := &http.Server{
-		Addr:    fd.Config.RedirectURI + ":" + fd.Config.RedirectPort,
+		Addr:    ":" + fd.Config.RedirectPort,
 		Handler: mux,
 	}
 	// ERROR handling the index page for the server
@@ -289,12 +257,18 @@ func (fd *FitbitDownloader) startCallbackServer(authCodeChan chan<- string, errC
 		if code != "" {
 			w.Header().Set("Content-Type", "text/html")
 			w.Write([]byte("Authorization successful! You can close this window and return to the application."))
-			authCodeChan <- code
+			select {
+			case authCodeChan <- code:
+			default: // a code was already received
+			}
 		} else {
 			w.Header().Set("Content-Type", "text/html")
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte("Authorization failed. Please try again."))
-			errChan <- fmt.Errorf("authorization failed, no code received")
+			select {
+			case errChan <- fmt.Errorf("authorization failed, no code received"):
+			default:
+			}
 		}
 
 		// Shutdown the server after handling the request
@@ -305,16 +279,25 @@ func (fd *FitbitDownloader) startCallbackServer(authCodeChan chan<- string, errC
 		}()
 	})
 
-	log.Println("Waiting for authorization callback...")
+	go func() {
+		<-stop
+		fd.callbackRunning = false
+		server.Close()
+	}()
+
+	slog.Info("Waiting for authorization callback")
 
 	if err := server.ListenAndServe(); err != http.ErrServerClosed {
-		errChan <- fmt.Errorf("HTTP server error: %v", err)
+		select {
+		case errChan <- fmt.Errorf("HTTP server error: %v", err):
+		default:
+		}
 	}
 }
 
 // getAccessToken exchanges the authorization code for an access token
 func (fd *FitbitDownloader) getAccessToken(authCode string) error {
-	fmt.Println("Exchanging authorization code for access token...")
+	slog.Info("Exchanging authorization code for access token")
 
 	tokenURL := "https://api.fitbit.com/oauth2/token"
 	data := url.Values{}
@@ -363,18 +346,13 @@ func (fd *FitbitDownloader) getAccessToken(authCode string) error {
 		return fmt.Errorf("failed to save token information: %v", err)
 	}
 
-	fmt.Println("Successfully obtained access token!")
+	slog.Info("Obtained access token", "user_id", fd.TokenInfo.UserID)
 	return nil
 }
 
 // saveTokenInfo saves the token information to a file
 func (fd *FitbitDownloader) saveTokenInfo() error {
-	tokenFile := filepath.Join(fd.DataDir, "token_info.json")
-	tokenData, err := json.MarshalIndent(fd.TokenInfo, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(tokenFile, tokenData, 0600)
+	return tokenManager(fd.DataDir).Save(fd.TokenInfo)
 }
 
 // loadTokenInfo loads token information from a file
@@ -392,76 +370,70 @@ func (fd *FitbitDownloader) LoadTokenInfo() error {
 	return json.Unmarshal(tokenData, &fd.TokenInfo)
 }
 
-// refreshAccessToken refreshes the access token if expired
+// RefreshAccessToken makes sure the access token is valid, refreshing it ahead of expiry.
+// The browser authorization flow is only restarted when Fitbit reports the grant as revoked.
 func (fd *FitbitDownloader) RefreshAccessToken() error {
-	// Try to load token info if not available
-	if fd.TokenInfo.AccessToken == "" {
-		err := fd.LoadTokenInfo()
-		if err != nil {
-			return fmt.Errorf("no access token available: %v", err)
+	tm := tokenManager(fd.DataDir)
+	token, err := tm.Token(fd.Config)
+	if errors.Is(err, ErrInvalidGrant) {
+		slog.Warn("Refresh token rejected", "err", err)
+		if settings.Headless {
+			return fmt.Errorf("no access token available, authorize the account again: %w", err)
 		}
-	}
-
-	// Check if token is expired
-	if time.Now().After(fd.TokenInfo.ExpiresAt) {
-		fmt.Println("Access token expired. Refreshing...")
-
-		tokenURL := "https://api.fitbit.com/oauth2/token"
-		data := url.Values{}
-		data.Set("grant_type", "refresh_token")
-		data.Set("refresh_token", fd.TokenInfo.RefreshToken)
 
-		req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
-		if err != nil {
-			return fmt.Errorf("failed to create refresh token request: %v", err)
+		// Remove the old token file
+		if err := tm.Remove(); err != nil {
+			return fmt.Errorf("failed to remove token file: %v", err)
 		}
 
-		// Create the authorization header value
-		authValue := base64.StdEncoding.EncodeToString([]byte(fd.Config.ClientID + ":" + fd.Config.ClientSecret))
-		req.Header.Set("Authorization", "Basic "+authValue)
-		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			return fmt.Errorf("refresh token request failed: %v", err)
-		}
-		defer resp.Body.Close()
+		// Restart the authentication process
+		slog.Info("Starting reauthentication process")
+		return fd.StartAuthFlow()
+	}
+	// Only a missing token needs a new authorization, anything else is worth a retry
+	if errors.Is(err, ErrNoToken) {
+		return fmt.Errorf("no access token available: %w", err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get access token, retry later: %w", err)
+	}
 
-		if resp.StatusCode != 200 {
-			bodyBytes, _ := io.ReadAll(resp.Body)
-			log.Printf("Failed to refresh access token: %d %s\n", resp.StatusCode, string(bodyBytes))
+	fd.TokenInfo = token
+	return nil
+}
 
-			// Remove the old token file
-			tokenFile := filepath.Join(fd.DataDir, "token_info.json")
-			if err := os.Remove(tokenFile); err != nil {
-				return fmt.Errorf("failed to remove token file: %v", err)
-			}
+// RevokeToken revokes the refresh token at Fitbit, which invalidates the whole grant
+func (fd *FitbitDownloader) RevokeToken() error {
+	if fd.TokenInfo.RefreshToken == "" {
+		return fmt.Errorf("no refresh token to revoke")
+	}
 
-			// Restart the authentication process
-			fmt.Println("Starting reauthentication process...")
-			return fd.StartAuthFlow()
-		}
+	revokeURL := "https://api.fitbit.com/oauth2/revoke"
+	data := url.Values{}
+	data.Set("token", fd.TokenInfo.RefreshToken)
 
-		var tokenResp TokenResponse
-		err = json.NewDecoder(resp.Body).Decode(&tokenResp)
-		if err != nil {
-			return fmt.Errorf("failed to decode refresh token response: %v", err)
-		}
+	req, err := http.NewRequest("POST", revokeURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create revoke request: %v", err)
+	}
 
-		fd.TokenInfo.AccessToken = tokenResp.AccessToken
-		fd.TokenInfo.RefreshToken = tokenResp.RefreshToken
-		fd.TokenInfo.ExpiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	authValue := base64.StdEncoding.EncodeToString([]byte(fd.Config.ClientID + ":" + fd.Config.ClientSecret))
+	req.Header.Set("Authorization", "Basic "+authValue)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-		// Save updated token information
-		err = fd.saveTokenInfo()
-		if err != nil {
-			return fmt.Errorf("failed to save updated token information: %v", err)
-		}
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("revoke request failed: %v", err)
+	}
+	defer resp.Body.Close()
 
-		fmt.Println("Successfully refreshed access token!")
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to revoke token: %d %s", resp.StatusCode, string(bodyBytes))
 	}
 
+	slog.Info("Fitbit token revoked")
 	return nil
 }
 
@@ -472,7 +444,7 @@ func (fd *FitbitDownloader) DownloadProfile() (*ProfileData, error) {
 		return nil, err
 	}
 
-	fmt.Println("Downloading user profile data...")
+	slog.Info("Downloading user profile data")
 	// TODO implement some type of emssage when quota is hit
 	url := "https://api.fitbit.com/1/user/-/profile.json"
 	req, err := http.NewRequest("GET", url, nil)
@@ -484,6 +456,12 @@ func (fd *FitbitDownloader) DownloadProfile() (*ProfileData, error) {
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("profile request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	fd.recordQuota(resp)
+
 	if resp.StatusCode == 429 {
 		retryAfterStr := resp.Header.Get("Retry-After")
 		retryAfter, _ := strconv.Atoi(retryAfterStr)
@@ -496,10 +474,6 @@ func (fd *FitbitDownloader) DownloadProfile() (*ProfileData, error) {
 			Message:    string(bodyBytes),
 		}
 	}
-	if err != nil {
-		return nil, fmt.Errorf("profile request failed: %v", err)
-	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
@@ -519,17 +493,18 @@ func (fd *FitbitDownloader) DownloadProfile() (*ProfileData, error) {
 		return nil, fmt.Errorf("failed to parse profile JSON: %v", err)
 	}
 
-	fmt.Printf("Profile data for: %s downloaded successfully\n", string(profileData.User.FullName))
+	slog.Info("Profile data downloaded", "name", profileData.User.FullName)
 
 	return &profileData, nil
 }
 
-func (fd *FitbitDownloader) DownloadActivities(activity string, days_back int) (*ActivityData, error) {
+// DownloadActivities downloads the daily values of an activity, r must not be longer than Fitbit allows
+func (fd *FitbitDownloader) DownloadActivities(activity string, r DateRange) (*ActivityData, error) {
 
-	endDate := time.Now().Format("2006-01-02")
-	startDate := time.Now().AddDate(0, 0, -days_back).Format("2006-01-02")
+	startDate := r.From.Format("2006-01-02")
+	endDate := r.To.Format("2006-01-02")
 
-	fmt.Printf("Reading %s data from %s to %s...\n", activity, startDate, endDate)
+	slog.Info("Downloading activity data", "activity", activity, "from", startDate, "to", endDate)
 
 	endpoint := fmt.Sprintf("https://api.fitbit.com/1/user/-/activities/%s/date/%s/%s.json", activity, startDate, endDate)
 
@@ -540,16 +515,17 @@ func (fd *FitbitDownloader) DownloadActivities(activity string, days_back int) (
 
 	// Populate Activity Type
 	data.ActivityType = activity
-	fmt.Printf("%s data downloaded successfully!\n", activity)
+	slog.Debug("Activity data downloaded", "activity", activity)
 	return data, nil
 }
 
-func (fd *FitbitDownloader) DownloadHeartRate(days_back int) (*ActivitiesHeartList, error) {
+// DownloadHeartRate downloads the daily heart rate summaries, r must not be longer than a year
+func (fd *FitbitDownloader) DownloadHeartRate(r DateRange) (*ActivitiesHeartList, error) {
 
-	endData := time.Now().Format("2006-01-02")
-	startDate := time.Now().AddDate(0, 0, -days_back).Format("2006-01-02")
+	startDate := r.From.Format("2006-01-02")
+	endData := r.To.Format("2006-01-02")
 
-	fmt.Printf("Reading heart rate data from %s to %s...\n", startDate, endData)
+	slog.Info("Downloading heart rate data", "from", startDate, "to", endData)
 
 	endpoint := fmt.Sprintf("https://api.fitbit.com/1/user/-/activities/heart/date/%s/%s.json", startDate, endData)
 
@@ -557,7 +533,7 @@ func (fd *FitbitDownloader) DownloadHeartRate(days_back int) (*ActivitiesHeartLi
 	if err != nil {
 		return nil, fmt.Errorf("failed to download heart rate data: %v", err)
 	}
-	fmt.Println("Heart rate data downloaded successfully!")
+	slog.Debug("Heart rate data downloaded")
 	return data, nil
 }
 
@@ -577,6 +553,7 @@ func (fd *FitbitDownloader) getData(endpoint string) (*ActivityData, error) {
 		return nil, fmt.Errorf("request for %s failed: %v", endpoint, err)
 	}
 	defer resp.Body.Close()
+	fd.recordQuota(resp)
 
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("failed to download %s data: %d", endpoint, resp.StatusCode)
@@ -609,6 +586,7 @@ func (fd *FitbitDownloader) getDataHeartRate(endpoint string) (*ActivitiesHeartL
 		return nil, fmt.Errorf("request for %s failed: %v", endpoint, err)
 	}
 	defer resp.Body.Close()
+	fd.recordQuota(resp)
 
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("failed to download %s data: %d", endpoint, resp.StatusCode)
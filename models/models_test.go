@@ -0,0 +1,28 @@
+package models
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartAuthFlowRejectsConcurrentFlows(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "alice")
+	// A flow waiting on the browser holds the data directory
+	authFlowsMu.Lock()
+	authFlows[dataDir] = true
+	authFlowsMu.Unlock()
+	t.Cleanup(func() {
+		authFlowsMu.Lock()
+		delete(authFlows, dataDir)
+		authFlowsMu.Unlock()
+	})
+
+	fd := &FitbitDownloader{DataDir: dataDir + "/"}
+	if err := fd.StartAuthFlow(); !errors.Is(err, ErrAuthInProgress) {
+		t.Errorf("second flow returned %v, want %v", err, ErrAuthInProgress)
+	}
+	if err := Authorize("id", "secret", dataDir); !errors.Is(err, ErrAuthInProgress) {
+		t.Errorf("Authorize returned %v, want %v", err, ErrAuthInProgress)
+	}
+}
@@ -0,0 +1,354 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RuleKind is the condition a notification rule watches
+type RuleKind string
+
+const (
+	// RuleBelow fires when a metric of today is under Threshold at the time of day At
+	RuleBelow RuleKind = "below"
+	// RuleBaseline fires when the value of a metric yesterday differs from the mean of the
+	// Days before by Threshold or more, a negative Threshold watches for drops
+	RuleBaseline RuleKind = "baseline"
+	// RuleSyncFailing fires when nothing or some metric was not downloaded for Hours
+	RuleSyncFailing RuleKind = "sync_failing"
+	// RuleTokenRevoked fires when Fitbit rejected the refresh token
+	RuleTokenRevoked RuleKind = "token_revoked"
+)
+
+// RuleKinds lists the kinds of rules offered on the notifications page
+var RuleKinds = []RuleKind{RuleBelow, RuleBaseline, RuleSyncFailing, RuleTokenRevoked}
+
+// Rule is one condition notified about after syncs. The fields used depend on Kind.
+type Rule struct {
+	ID        int      `json:"id"`
+	Kind      RuleKind `json:"kind"`
+	Metric    string   `json:"metric,omitempty"`
+	Threshold int      `json:"threshold,omitempty"`
+	At        string   `json:"at,omitempty"` // 15:04
+	Days      int      `json:"days,omitempty"`
+	Hours     int      `json:"hours,omitempty"`
+}
+
+// defaultRules watch the account itself until the rules are changed
+var defaultRules = []Rule{
+	{ID: 1, Kind: RuleSyncFailing, Hours: 24},
+	{ID: 2, Kind: RuleTokenRevoked},
+}
+
+// Validate reports the first field of r that does not fit its kind
+func (r Rule) Validate() error {
+	switch r.Kind {
+	case RuleBelow, RuleBaseline:
+		if _, ok := LookupMetric(r.Metric); !ok {
+			return fmt.Errorf("unknown metric %q", r.Metric)
+		}
+		if r.Kind == RuleBelow {
+			if _, err := time.Parse("15:04", r.At); err != nil {
+				return fmt.Errorf("time %q must be HH:MM", r.At)
+			}
+			if r.Threshold <= 0 {
+				return fmt.Errorf("threshold must be positive")
+			}
+			return nil
+		}
+		if r.Threshold == 0 {
+			return fmt.Errorf("change must not be 0")
+		}
+		if r.Days < 1 || r.Days > 90 {
+			return fmt.Errorf("baseline must be between 1 and 90 days")
+		}
+	case RuleSyncFailing:
+		if r.Hours < 1 {
+			return fmt.Errorf("hours must be positive")
+		}
+	case RuleTokenRevoked:
+	default:
+		return fmt.Errorf("unknown rule kind %q", r.Kind)
+	}
+	return nil
+}
+
+// String describes the rule, e.g. "Steps below 5000 by 18:00"
+func (r Rule) String() string {
+	m, _ := LookupMetric(r.Metric)
+	switch r.Kind {
+	case RuleBelow:
+		return fmt.Sprintf("%s below %d by %s", m.Label, r.Threshold, r.At)
+	case RuleBaseline:
+		direction := "up"
+		if r.Threshold < 0 {
+			direction = "down"
+		}
+		return fmt.Sprintf("%s %s %d %s over the %d-day baseline", m.Label, direction, abs(r.Threshold), m.Unit, r.Days)
+	case RuleSyncFailing:
+		return fmt.Sprintf("Sync failing for %dh", r.Hours)
+	case RuleTokenRevoked:
+		return "Fitbit authorization revoked"
+	}
+	return string(r.Kind)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Notification is a fired rule, kept in the inbox of the dashboard
+type Notification struct {
+	ID      int       `json:"id"`
+	Rule    int       `json:"rule"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+	Read    bool      `json:"read"`
+}
+
+// maxInbox is the number of notifications kept in the inbox
+const maxInbox = 100
+
+// NotificationFile is the notifications.json of a data directory
+type NotificationFile struct {
+	// Rules are nil until changed on the notifications page, the default rules apply then
+	Rules  []Rule `json:"rules"`
+	NextID int    `json:"next_id"`
+	// Fired holds what each rule last fired for by rule ID: a date, or the outage it is in
+	Fired map[string]string `json:"fired,omitempty"`
+	// Inbox holds the latest notifications, newest first
+	Inbox []Notification `json:"inbox,omitempty"`
+}
+
+// ActiveRules returns the rules in use
+func (f NotificationFile) ActiveRules() []Rule {
+	if f.Rules == nil {
+		return defaultRules
+	}
+	return f.Rules
+}
+
+// Unread counts the unread notifications of the inbox
+func (f NotificationFile) Unread() int {
+	unread := 0
+	for _, n := range f.Inbox {
+		if !n.Read {
+			unread++
+		}
+	}
+	return unread
+}
+
+// notificationsMu serializes the updates of notifications.json by syncs and the notifications page
+var notificationsMu sync.Mutex
+
+// LoadNotifications reads the rules and inbox of dataDir
+func LoadNotifications(dataDir string) (NotificationFile, error) {
+	var f NotificationFile
+	data, err := os.ReadFile(filepath.Join(dataDir, "notifications.json"))
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return f, fmt.Errorf("failed to read notifications: %w", err)
+	}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("failed to parse notifications: %w", err)
+	}
+	return f, nil
+}
+
+// updateNotifications changes notifications.json of dataDir with update
+func updateNotifications(dataDir string, update func(*NotificationFile) error) error {
+	notificationsMu.Lock()
+	defer notificationsMu.Unlock()
+
+	f, err := LoadNotifications(dataDir)
+	if err != nil {
+		return err
+	}
+	if f.NextID == 0 {
+		f.NextID = len(defaultRules) + 1
+	}
+	if err := update(&f); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal notifications: %w", err)
+	}
+	return writeFileAtomic(filepath.Join(dataDir, "notifications.json"), data, 0644)
+}
+
+// AddRule validates r and adds it to the rules of dataDir
+func AddRule(dataDir string, r Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	return updateNotifications(dataDir, func(f *NotificationFile) error {
+		f.Rules = slices.Clone(f.ActiveRules())
+		r.ID = f.NextID
+		f.NextID++
+		f.Rules = append(f.Rules, r)
+		return nil
+	})
+}
+
+// DeleteRule removes the rule with id from the rules of dataDir
+func DeleteRule(dataDir string, id int) error {
+	return updateNotifications(dataDir, func(f *NotificationFile) error {
+		f.Rules = slices.DeleteFunc(slices.Clone(f.ActiveRules()), func(r Rule) bool { return r.ID == id })
+		delete(f.Fired, strconv.Itoa(id))
+		return nil
+	})
+}
+
+// AddToInbox stores notifications in the inbox of dataDir, dropping the oldest beyond maxInbox
+func AddToInbox(dataDir string, notifications []Notification) error {
+	return updateNotifications(dataDir, func(f *NotificationFile) error {
+		for _, n := range notifications {
+			n.ID = f.NextID
+			f.NextID++
+			f.Inbox = append([]Notification{n}, f.Inbox...)
+		}
+		f.Inbox = f.Inbox[:min(len(f.Inbox), maxInbox)]
+		return nil
+	})
+}
+
+// MarkInboxRead marks every notification of the inbox of dataDir as read
+func MarkInboxRead(dataDir string) error {
+	return updateNotifications(dataDir, func(f *NotificationFile) error {
+		for i := range f.Inbox {
+			f.Inbox[i].Read = true
+		}
+		return nil
+	})
+}
+
+// EvaluateRules checks the rules of dataDir after a sync that ended with syncErr and
+// returns the notifications of the rules that fired. A rule fires once a day for
+// metrics, and once per outage for sync problems.
+func EvaluateRules(dataDir string, syncErr error, now time.Time) ([]Notification, error) {
+	store := StoreFor(dataDir)
+	var fired []Notification
+	err := updateNotifications(dataDir, func(f *NotificationFile) error {
+		if f.Fired == nil {
+			f.Fired = map[string]string{}
+		}
+		for _, rule := range f.ActiveRules() {
+			id := strconv.Itoa(rule.ID)
+			key, n, ok := store.checkRule(rule, dataDir, syncErr, now)
+			if !ok {
+				// The outage is over, the next one is notified again
+				if rule.Kind == RuleSyncFailing || rule.Kind == RuleTokenRevoked {
+					delete(f.Fired, id)
+				}
+				continue
+			}
+			if f.Fired[id] == key {
+				continue
+			}
+			f.Fired[id] = key
+			n.Rule, n.At = rule.ID, now
+			fired = append(fired, n)
+		}
+		return nil
+	})
+	return fired, err
+}
+
+// checkRule reports whether rule holds for the store of dataDir, with what it fired for
+// and the notification to send
+func (s *DataStore) checkRule(rule Rule, dataDir string, syncErr error, now time.Time) (string, Notification, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	today := civilDate(now)
+	m, _ := LookupMetric(rule.Metric)
+	switch rule.Kind {
+	case RuleBelow:
+		at, _ := time.Parse("15:04", rule.At)
+		if now.Hour()*60+now.Minute() < at.Hour()*60+at.Minute() || !s.History.Has(m.Source, today) {
+			return "", Notification{}, false
+		}
+		value := m.Value(s.History.Days[today.Format(time.DateOnly)])
+		if value >= rule.Threshold {
+			return "", Notification{}, false
+		}
+		return today.Format(time.DateOnly), Notification{
+			Title:   rule.String(),
+			Message: fmt.Sprintf("%d %s so far today, %d to go.", value, m.Unit, rule.Threshold-value),
+		}, true
+
+	case RuleBaseline:
+		// Today is still being counted, so the last complete day is judged
+		yesterday := today.AddDate(0, 0, -1)
+		latest := s.History.daily(m, DateRange{From: yesterday, To: yesterday})
+		if len(latest) == 0 {
+			return "", Notification{}, false
+		}
+		day := latest[0]
+		baseline := s.History.values(m, DateRange{From: day.Date.AddDate(0, 0, -rule.Days), To: day.Date.AddDate(0, 0, -1)})
+		// A baseline of mostly missing days says little
+		if len(baseline)*2 < rule.Days || len(baseline) == 0 {
+			return "", Notification{}, false
+		}
+		mean := mean(baseline)
+		change := float64(day.Value) - mean
+		if (rule.Threshold > 0 && change < float64(rule.Threshold)) || (rule.Threshold < 0 && change > float64(rule.Threshold)) {
+			return "", Notification{}, false
+		}
+		return day.Date.Format(time.DateOnly), Notification{
+			Title: rule.String(),
+			Message: fmt.Sprintf("%d %s on %s, %+.1f against the %d-day baseline of %.1f.",
+				day.Value, m.Unit, day.Date.Format(time.DateOnly), change, rule.Days, mean),
+		}, true
+
+	case RuleSyncFailing:
+		since := now.Add(-time.Duration(rule.Hours) * time.Hour)
+		var stale []string
+		if syncErr != nil && s.syncedAt.Before(since) {
+			stale = append(stale, "everything")
+		} else {
+			for _, metric := range HistoryMetrics {
+				if at, ok := s.metricSyncedAt[metric]; ok && at.Before(since) {
+					stale = append(stale, metric)
+				}
+			}
+		}
+		if len(stale) == 0 {
+			return "", Notification{}, false
+		}
+		message := fmt.Sprintf("Nothing was downloaded for %dh.", rule.Hours)
+		if stale[0] != "everything" {
+			message = fmt.Sprintf("No %s downloaded for %dh.", strings.Join(stale, ", "), rule.Hours)
+		}
+		if syncErr != nil {
+			message += " Last error: " + syncErr.Error()
+		}
+		return "failing", Notification{Title: rule.String(), Message: message}, true
+
+	case RuleTokenRevoked:
+		if !errors.Is(syncErr, ErrInvalidGrant) && !TokenRevoked(dataDir) {
+			return "", Notification{}, false
+		}
+		return "revoked", Notification{
+			Title:   rule.String(),
+			Message: "Fitbit rejected the refresh token, authorize the account again to resume syncing.",
+		}, true
+	}
+	return "", Notification{}, false
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRulesAccount returns a data directory whose store holds the daily steps of steps,
+// keyed by date, with rules as its notification rules
+func newRulesAccount(t *testing.T, steps map[string]int, rules ...Rule) (string, *DataStore) {
+	t.Helper()
+	dataDir := t.TempDir()
+	store := StoreFor(dataDir)
+	store.mu.Lock()
+	store.History = History{Days: map[string]DayRecord{}, Fetched: map[string]DateRange{}}
+	var fetched DateRange
+	for date, value := range steps {
+		day, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		store.History.Days[date] = DayRecord{Steps: value}
+		if fetched.From.IsZero() || day.Before(fetched.From) {
+			fetched.From = day
+		}
+		if day.After(fetched.To) {
+			fetched.To = day
+		}
+	}
+	store.History.Fetched["steps"] = fetched
+	store.mu.Unlock()
+
+	for _, r := range rules {
+		if err := AddRule(dataDir, r); err != nil {
+			t.Fatalf("AddRule: %v", err)
+		}
+	}
+	return dataDir, store
+}
+
+// evaluate runs the rules of dataDir at now and returns the titles of those that fired
+func evaluate(t *testing.T, dataDir string, syncErr error, now time.Time) []string {
+	t.Helper()
+	fired, err := EvaluateRules(dataDir, syncErr, now)
+	if err != nil {
+		t.Fatalf("EvaluateRules: %v", err)
+	}
+	var titles []string
+	for _, n := range fired {
+		titles = append(titles, n.Title)
+	}
+	slices.Sort(titles)
+	return titles
+}
+
+// at returns the time of day hh:mm on date
+func at(date, clock string) time.Time {
+	t, err := time.Parse(time.DateOnly+" 15:04", date+" "+clock)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestEvaluateRulesBelowOncePerDay(t *testing.T) {
+	below := Rule{Kind: RuleBelow, Metric: "steps", Threshold: 10000, At: "18:00"}
+	dataDir, store := newRulesAccount(t, map[string]int{"2025-10-14": 12000, "2025-10-15": 4000}, below)
+	title := below.String()
+
+	if got := evaluate(t, dataDir, nil, at("2025-10-15", "17:59")); slices.Contains(got, title) {
+		t.Errorf("fired before 18:00: %v", got)
+	}
+	if got := evaluate(t, dataDir, nil, at("2025-10-15", "18:30")); !slices.Contains(got, title) {
+		t.Errorf("did not fire at 18:30: %v", got)
+	}
+	if got := evaluate(t, dataDir, nil, at("2025-10-15", "21:00")); slices.Contains(got, title) {
+		t.Errorf("fired twice on one day: %v", got)
+	}
+
+	store.mu.Lock()
+	store.History.Days["2025-10-16"] = DayRecord{Steps: 3000}
+	store.History.Fetched["steps"] = DateRange{From: store.History.Fetched["steps"].From, To: at("2025-10-16", "00:00")}
+	store.mu.Unlock()
+	if got := evaluate(t, dataDir, nil, at("2025-10-16", "18:30")); !slices.Contains(got, title) {
+		t.Errorf("did not fire again the next day: %v", got)
+	}
+}
+
+func TestEvaluateRulesBaselineJudgesYesterday(t *testing.T) {
+	drop := Rule{Kind: RuleBaseline, Metric: "steps", Threshold: -3000, Days: 7}
+	steps := map[string]int{}
+	for day := 7; day <= 13; day++ {
+		steps[fmt.Sprintf("2025-10-%02d", day)] = 8000
+	}
+	// Yesterday was an ordinary day, today has barely started
+	steps["2025-10-14"] = 8200
+	steps["2025-10-15"] = 150
+	dataDir, store := newRulesAccount(t, steps, drop)
+	title := drop.String()
+
+	if got := evaluate(t, dataDir, nil, at("2025-10-15", "08:00")); slices.Contains(got, title) {
+		t.Errorf("fired on the partial day of today: %v", got)
+	}
+
+	// The next morning yesterday is complete and far below the baseline
+	store.mu.Lock()
+	store.History.Days["2025-10-16"] = DayRecord{Steps: 100}
+	store.History.Fetched["steps"] = DateRange{From: store.History.Fetched["steps"].From, To: at("2025-10-16", "00:00")}
+	store.mu.Unlock()
+	fired, err := EvaluateRules(dataDir, nil, at("2025-10-16", "08:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fired) != 1 || fired[0].Title != title {
+		t.Fatalf("fired %v, want the baseline rule", fired)
+	}
+	if want := "150 steps on 2025-10-15"; !strings.HasPrefix(fired[0].Message, want) {
+		t.Errorf("message %q, want it to start with %q", fired[0].Message, want)
+	}
+	if got := evaluate(t, dataDir, nil, at("2025-10-16", "20:00")); slices.Contains(got, title) {
+		t.Errorf("fired twice for one day: %v", got)
+	}
+}
+
+func TestEvaluateRulesOncePerOutage(t *testing.T) {
+	// The default rules watch for failing syncs and a revoked authorization
+	dataDir, store := newRulesAccount(t, map[string]int{"2025-10-15": 5000})
+	revoked := Rule{Kind: RuleTokenRevoked}.String()
+	failing := Rule{Kind: RuleSyncFailing, Hours: 24}.String()
+	now := at("2025-10-15", "12:00")
+	rejected := fmt.Errorf("failed to refresh token: %w", ErrInvalidGrant)
+
+	store.mu.Lock()
+	store.syncedAt = now.Add(-30 * time.Hour)
+	store.mu.Unlock()
+	if got := evaluate(t, dataDir, rejected, now); !slices.Equal(got, []string{revoked, failing}) {
+		t.Errorf("fired %v, want %v", got, []string{revoked, failing})
+	}
+	for hour := 1; hour <= 3; hour++ {
+		if got := evaluate(t, dataDir, rejected, now.Add(time.Duration(hour)*time.Hour)); len(got) > 0 {
+			t.Errorf("fired %v again during the outage", got)
+		}
+	}
+
+	// A successful sync ends the outage, the next one is notified again
+	store.mu.Lock()
+	store.syncedAt = now.Add(4 * time.Hour)
+	store.metricSyncedAt = map[string]time.Time{"steps": now.Add(4 * time.Hour)}
+	store.mu.Unlock()
+	if got := evaluate(t, dataDir, nil, now.Add(4*time.Hour)); len(got) > 0 {
+		t.Errorf("fired %v after a successful sync", got)
+	}
+	if got := evaluate(t, dataDir, rejected, now.Add(5*time.Hour)); !slices.Equal(got, []string{revoked}) {
+		t.Errorf("fired %v, want %v", got, []string{revoked})
+	}
+}
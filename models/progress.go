@@ -0,0 +1,157 @@
+package models
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Status values of a SyncEvent
+const (
+	SyncStarted = "started"
+	SyncDone    = "done"
+	SyncFailed  = "failed"
+)
+
+// SyncMetrics lists what a sync downloads, in the order the dashboard shows its progress.
+// It ends with looking for personal records in the downloaded days.
+var SyncMetrics = append(append([]string{"profile", "goals"}, HistoryMetrics...), "records")
+
+// SyncEvent reports the progress of a background sync. Metric is one of SyncMetrics or
+// "authorization" while the browser flow runs, and empty for the end of the whole sync.
+type SyncEvent struct {
+	Metric string `json:"metric"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// syncRun is a background sync with the watchers of its progress
+type syncRun struct {
+	progress map[string]SyncEvent // latest event per metric
+	watchers map[chan SyncEvent]struct{}
+}
+
+var (
+	syncRunsMu  sync.Mutex
+	syncRuns    = map[string]*syncRun{}  // by data directory
+	lastResults = map[string]SyncEvent{} // final event of the last finished sync
+)
+
+// StartSync downloads the data of dataDir missing since the account was created in the
+// background, so every range of the dashboard can be shown from the store. It returns
+// false when a sync of dataDir is already running or shutdown began.
+func StartSync(clientID, clientSecret, dataDir string) bool {
+	syncRunsMu.Lock()
+	if _, running := syncRuns[dataDir]; running {
+		syncRunsMu.Unlock()
+		return false
+	}
+	// Added before the goroutine runs, so shutdown either waits for it or it never starts
+	if !beginSync() {
+		syncRunsMu.Unlock()
+		return false
+	}
+	syncRuns[dataDir] = &syncRun{
+		progress: map[string]SyncEvent{},
+		watchers: map[chan SyncEvent]struct{}{},
+	}
+	syncRunsMu.Unlock()
+
+	go func() {
+		defer activeSyncs.Done()
+		err := runSync(clientID, clientSecret, dataDir, 0)
+		if err != nil {
+			slog.Error("Background sync failed", "dir", dataDir, "err", err)
+		}
+		finishSync(dataDir, err)
+	}()
+	return true
+}
+
+// SyncRunning reports whether a background sync of dataDir is in progress
+func SyncRunning(dataDir string) bool {
+	syncRunsMu.Lock()
+	defer syncRunsMu.Unlock()
+	_, running := syncRuns[dataDir]
+	return running
+}
+
+// LastSyncResult returns the final event of the last background sync of dataDir
+func LastSyncResult(dataDir string) (SyncEvent, bool) {
+	syncRunsMu.Lock()
+	defer syncRunsMu.Unlock()
+	e, ok := lastResults[dataDir]
+	return e, ok
+}
+
+// WatchSync subscribes to the progress of the running sync of dataDir. It returns the
+// events so far and a channel with the following ones, which is closed after the final
+// event. ok is false when no sync is running. stop must be called when done watching.
+func WatchSync(dataDir string) (past []SyncEvent, events <-chan SyncEvent, stop func(), ok bool) {
+	syncRunsMu.Lock()
+	defer syncRunsMu.Unlock()
+
+	run, running := syncRuns[dataDir]
+	if !running {
+		return nil, nil, func() {}, false
+	}
+	for _, metric := range append([]string{"authorization"}, SyncMetrics...) {
+		if e, ok := run.progress[metric]; ok {
+			past = append(past, e)
+		}
+	}
+
+	ch := make(chan SyncEvent, 16)
+	run.watchers[ch] = struct{}{}
+	stop = func() {
+		syncRunsMu.Lock()
+		defer syncRunsMu.Unlock()
+		// finishSync closes and forgets the channel when the sync ends first
+		if _, ok := run.watchers[ch]; ok {
+			delete(run.watchers, ch)
+			close(ch)
+		}
+	}
+	return past, ch, stop, true
+}
+
+// publishSync passes an event to the watchers of the running sync of dataDir, if any
+func publishSync(dataDir string, e SyncEvent) {
+	syncRunsMu.Lock()
+	defer syncRunsMu.Unlock()
+
+	run, running := syncRuns[dataDir]
+	if !running {
+		return
+	}
+	run.progress[e.Metric] = e
+	for ch := range run.watchers {
+		// A watcher that does not keep up misses events rather than stalling the sync
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// finishSync sends the final event and ends the run
+func finishSync(dataDir string, err error) {
+	e := SyncEvent{Status: SyncDone}
+	if err != nil {
+		e = SyncEvent{Status: SyncFailed, Error: err.Error()}
+	}
+
+	syncRunsMu.Lock()
+	defer syncRunsMu.Unlock()
+
+	run := syncRuns[dataDir]
+	delete(syncRuns, dataDir)
+	lastResults[dataDir] = e
+	for ch := range run.watchers {
+		select {
+		case ch <- e:
+		default:
+		}
+		close(ch)
+	}
+	run.watchers = nil
+}
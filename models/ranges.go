@@ -0,0 +1,234 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateRange is an inclusive span of calendar days. Dates are midnight UTC so day
+// arithmetic is not thrown off by daylight saving changes.
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+type dateRangeJSON struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (r DateRange) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dateRangeJSON{From: r.From.Format(time.DateOnly), To: r.To.Format(time.DateOnly)})
+}
+
+func (r *DateRange) UnmarshalJSON(data []byte) error {
+	var raw dateRangeJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	from, err := time.Parse(time.DateOnly, raw.From)
+	if err != nil {
+		return err
+	}
+	to, err := time.Parse(time.DateOnly, raw.To)
+	if err != nil {
+		return err
+	}
+	r.From, r.To = from, to
+	return nil
+}
+
+// Days returns the number of days in the range
+func (r DateRange) Days() int {
+	// Unix seconds, a Duration saturates for ranges of about 292 years
+	return int((r.To.Unix()-r.From.Unix())/(24*60*60)) + 1
+}
+
+// Contains reports whether date falls in the range
+func (r DateRange) Contains(date time.Time) bool {
+	return !date.Before(r.From) && !date.After(r.To)
+}
+
+func (r DateRange) String() string {
+	return r.From.Format(time.DateOnly) + " to " + r.To.Format(time.DateOnly)
+}
+
+// civilDate returns the calendar day of t as a DateRange date
+func civilDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Today returns the current local calendar day
+func Today() time.Time {
+	return civilDate(time.Now())
+}
+
+// LastDays returns the range of the last days ending today
+func LastDays(days int) DateRange {
+	today := Today()
+	return DateRange{From: today.AddDate(0, 0, -(days - 1)), To: today}
+}
+
+// Preset is a named date range offered next to the date pickers
+type Preset struct {
+	Name  string
+	Label string
+	// Resolve returns the range for today, earliest is the first day with data
+	Resolve func(today, earliest time.Time) DateRange
+}
+
+// Presets are the ranges offered by the dashboard, in display order
+var Presets = []Preset{
+	{"7d", "Last 7 days", func(today, _ time.Time) DateRange {
+		return DateRange{From: today.AddDate(0, 0, -6), To: today}
+	}},
+	{"30d", "Last 30 days", func(today, _ time.Time) DateRange {
+		return DateRange{From: today.AddDate(0, 0, -29), To: today}
+	}},
+	{"this-week", "This week", func(today, _ time.Time) DateRange {
+		// Weeks start on Monday
+		offset := (int(today.Weekday()) + 6) % 7
+		return DateRange{From: today.AddDate(0, 0, -offset), To: today}
+	}},
+	{"last-month", "Last month", func(today, _ time.Time) DateRange {
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return DateRange{From: first.AddDate(0, -1, 0), To: first.AddDate(0, 0, -1)}
+	}},
+	{"ytd", "Year to date", func(today, _ time.Time) DateRange {
+		return DateRange{From: time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC), To: today}
+	}},
+	{"12m", "Last 12 months", func(today, _ time.Time) DateRange {
+		return DateRange{From: today.AddDate(-1, 0, 1), To: today}
+	}},
+	{"all", "All time", func(today, earliest time.Time) DateRange {
+		if earliest.IsZero() || earliest.After(today) {
+			earliest = today
+		}
+		return DateRange{From: earliest, To: today}
+	}},
+}
+
+// PresetRange resolves the preset called name
+func PresetRange(name string, earliest time.Time) (DateRange, bool) {
+	for _, p := range Presets {
+		if p.Name == name {
+			return p.Resolve(Today(), earliest), true
+		}
+	}
+	return DateRange{}, false
+}
+
+// ParseDateRange reads a from/to pair of dates, either may be empty and then
+// defaults to the earliest day with data or today. The range is clamped to the days
+// from earliest to today, so no request walks centuries of empty days.
+func ParseDateRange(from, to string, earliest time.Time) (DateRange, error) {
+	r := DateRange{From: earliest, To: Today()}
+	var err error
+	if from != "" {
+		if r.From, err = time.Parse(time.DateOnly, from); err != nil {
+			return DateRange{}, fmt.Errorf("invalid from date %q", from)
+		}
+	}
+	if to != "" {
+		if r.To, err = time.Parse(time.DateOnly, to); err != nil {
+			return DateRange{}, fmt.Errorf("invalid to date %q", to)
+		}
+	}
+	// 0001-01-01 parses to the zero time too, only an empty from falls back to to
+	if from == "" && r.From.IsZero() {
+		r.From = r.To
+	}
+	if r.To.Before(r.From) {
+		return DateRange{}, fmt.Errorf("from date %s is after to date %s", r.From.Format(time.DateOnly), r.To.Format(time.DateOnly))
+	}
+	return r.clamp(earliest, Today()), nil
+}
+
+// clamp moves both ends of r into the days from earliest to today, a zero earliest
+// means there is no data before today
+func (r DateRange) clamp(earliest, today time.Time) DateRange {
+	if earliest.IsZero() || earliest.After(today) {
+		earliest = today
+	}
+	bound := func(t time.Time) time.Time {
+		if t.Before(earliest) {
+			return earliest
+		}
+		if t.After(today) {
+			return today
+		}
+		return t
+	}
+	return DateRange{From: bound(r.From), To: bound(r.To)}
+}
+
+// Granularity is the size of the buckets a chart is drawn with
+type Granularity string
+
+const (
+	Daily   Granularity = "day"
+	Weekly  Granularity = "week"
+	Monthly Granularity = "month"
+	Yearly  Granularity = "year"
+)
+
+// GranularityFor picks daily points for short ranges and weekly or monthly averages
+// once a range has too many days to read as single bars
+func GranularityFor(r DateRange) Granularity {
+	switch days := r.Days(); {
+	case days > 180:
+		return Monthly
+	case days > 45:
+		return Weekly
+	}
+	return Daily
+}
+
+// bucketStart returns the first day of the bucket date falls in
+func (g Granularity) bucketStart(date time.Time) time.Time {
+	switch g {
+	case Weekly:
+		return date.AddDate(0, 0, -((int(date.Weekday()) + 6) % 7))
+	case Monthly:
+		return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case Yearly:
+		return time.Date(date.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return date
+}
+
+// next returns the start of the bucket after the one starting at start
+func (g Granularity) next(start time.Time) time.Time {
+	return g.shift(start, 1)
+}
+
+// shift moves date by n buckets: days, runs of 7 days, months or years
+func (g Granularity) shift(date time.Time, n int) time.Time {
+	switch g {
+	case Weekly:
+		return date.AddDate(0, 0, 7*n)
+	case Monthly:
+		return date.AddDate(0, n, 0)
+	case Yearly:
+		return date.AddDate(n, 0, 0)
+	}
+	return date.AddDate(0, 0, n)
+}
+
+// label names the bucket starting at start on the x axis
+func (g Granularity) label(start time.Time, r DateRange) string {
+	switch g {
+	case Weekly:
+		year, week := start.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case Monthly:
+		return start.Format("Jan 2006")
+	case Yearly:
+		return start.Format("2006")
+	}
+	if r.From.Year() != r.To.Year() {
+		return start.Format(time.DateOnly)
+	}
+	return start.Format("Mon 01-02")
+}
@@ -0,0 +1,327 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// activeStreakMinutes is the number of active minutes a day needs to extend an active streak
+const activeStreakMinutes = 30
+
+// DistanceMilestones are the lifetime distances in km worth celebrating, the last one
+// is the circumference of the earth
+var DistanceMilestones = []int{100, 250, 500, 1000, 2500, 5000, 10000, 20000, 40075}
+
+// RecordKind is one personal best kept in records.json
+type RecordKind struct {
+	Name  string
+	Label string
+	Unit  string
+	// Lowest marks records won by the lowest value
+	Lowest bool
+	// source is the download the candidates are read from
+	source string
+	// candidates returns the values of the days, weeks or streaks ending in r
+	candidates func(h *History, r DateRange) []dailyValue
+}
+
+// RecordKinds lists the personal records in display order
+var RecordKinds = []RecordKind{
+	{Name: "most_steps_day", source: "steps", Label: "Most steps in a day", Unit: "steps", candidates: dayRecords("steps")},
+	{Name: "most_steps_week", source: "steps", Label: "Most steps in a week", Unit: "steps", candidates: periodRecords("steps", Weekly)},
+	{Name: "most_steps_month", source: "steps", Label: "Most steps in a month", Unit: "steps", candidates: periodRecords("steps", Monthly)},
+	{Name: "most_floors_day", source: "floors", Label: "Most floors in a day", Unit: "floors", candidates: dayRecords("floors")},
+	{Name: "lowest_resting_heart_rate", source: "heart_rate", Label: "Lowest resting heart rate", Unit: "bpm", Lowest: true, candidates: dayRecords("resting_heart_rate")},
+	{Name: "longest_active_streak", source: "active_minutes", Label: "Longest active streak", Unit: "days", candidates: activeStreaks},
+}
+
+// dayRecords competes with the value of every day
+func dayRecords(metric string) func(*History, DateRange) []dailyValue {
+	return func(h *History, r DateRange) []dailyValue {
+		m, _ := LookupMetric(metric)
+		return h.daily(m, r)
+	}
+}
+
+// periodRecords competes with the totals of the weeks or months touching r, dated by their first day
+func periodRecords(metric string, g Granularity) func(*History, DateRange) []dailyValue {
+	return func(h *History, r DateRange) []dailyValue {
+		m, _ := LookupMetric(metric)
+		var totals []dailyValue
+		for start := g.bucketStart(r.From); !start.After(r.To); start = g.next(start) {
+			days := h.daily(m, DateRange{From: start, To: g.next(start).AddDate(0, 0, -1)})
+			if len(days) == 0 {
+				continue
+			}
+			total := 0
+			for _, d := range days {
+				total += d.Value
+			}
+			totals = append(totals, dailyValue{start, total})
+		}
+		return totals
+	}
+}
+
+// activeStreaks competes with the streak of active days ending on each day of r, dated by its first day
+func activeStreaks(h *History, r DateRange) []dailyValue {
+	m, _ := LookupMetric("active_minutes")
+	active := func(date time.Time) bool {
+		return h.Has(m.Source, date) && m.Value(h.Days[date.Format(time.DateOnly)]) >= activeStreakMinutes
+	}
+	var streaks []dailyValue
+	for date := r.From; !date.After(r.To); date = date.AddDate(0, 0, 1) {
+		if !active(date) {
+			continue
+		}
+		start := date
+		for active(start.AddDate(0, 0, -1)) {
+			start = start.AddDate(0, 0, -1)
+		}
+		streaks = append(streaks, dailyValue{start, int(date.Sub(start).Hours()/24) + 1})
+	}
+	return streaks
+}
+
+// Record is the best value of one record kind
+type Record struct {
+	Value int `json:"value"`
+	// Date is the day of the record, or the first day of its week, month or streak
+	Date string `json:"date"`
+	// SetAt is when a sync found the record beating the one before, Previous.
+	// Records found when the records were first computed have no SetAt.
+	SetAt    time.Time `json:"set_at"`
+	Previous int       `json:"previous,omitempty"`
+}
+
+// Milestone is a lifetime distance reached
+type Milestone struct {
+	Km    int       `json:"km"`
+	Date  string    `json:"date"`
+	SetAt time.Time `json:"set_at"`
+}
+
+// RecordFile is the records.json of a data directory
+type RecordFile struct {
+	Records    map[string]Record `json:"records"`
+	Milestones []Milestone       `json:"milestones,omitempty"`
+	// Checked holds the dates looked at so far for each metric, like History.Fetched
+	Checked map[string]DateRange `json:"checked,omitempty"`
+	// Distance is the lifetime distance in meters, DistanceBefore the part before
+	// the last checked day, which is looked at again on the next update
+	Distance       int       `json:"distance"`
+	DistanceBefore int       `json:"distance_before"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// recordsMu serializes updates of records.json
+var recordsMu sync.Mutex
+
+// LoadRecords reads the records of dataDir, empty before they are first computed
+func LoadRecords(dataDir string) (RecordFile, error) {
+	var records RecordFile
+	data, err := os.ReadFile(filepath.Join(dataDir, "records.json"))
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return records, fmt.Errorf("failed to read records: %w", err)
+	}
+	if err := json.Unmarshal(data, &records); err != nil {
+		return records, fmt.Errorf("failed to parse records: %w", err)
+	}
+	return records, nil
+}
+
+// CurrentRecords returns the records of dataDir, looking through the stored data first
+// when they were never computed, such as for data synced before records were kept
+func CurrentRecords(dataDir string) (RecordFile, error) {
+	records, err := LoadRecords(dataDir)
+	if err != nil || records.Checked != nil {
+		return records, err
+	}
+	records, _, err = UpdateRecords(dataDir)
+	return records, err
+}
+
+// UpdateRecords looks for new personal records in the days of the store of dataDir
+// downloaded since the last update. It returns the records and the names of the records
+// and milestones beaten.
+func UpdateRecords(dataDir string) (RecordFile, []string, error) {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	records, err := LoadRecords(dataDir)
+	if err != nil {
+		return records, nil, err
+	}
+	store := StoreFor(dataDir)
+	store.mu.RLock()
+	beaten := store.History.updateRecords(&records, time.Now())
+	store.mu.RUnlock()
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return records, nil, fmt.Errorf("failed to marshal records: %w", err)
+	}
+	if err := writeFileAtomic(filepath.Join(dataDir, "records.json"), data, 0644); err != nil {
+		return records, nil, err
+	}
+	return records, beaten, nil
+}
+
+// updateRecords checks the days downloaded since the last update against the records
+// of f. Only records beaten by newer days are marked as new, history filled in before
+// the checked dates sets records silently.
+func (h *History) updateRecords(f *RecordFile, now time.Time) []string {
+	if f.Records == nil {
+		f.Records = map[string]Record{}
+	}
+	if f.Checked == nil {
+		f.Checked = map[string]DateRange{}
+	}
+
+	var beaten []string
+	for _, kind := range RecordKinds {
+		older, newer := f.unchecked(h, kind.source)
+		for _, r := range []*DateRange{older, newer} {
+			if r == nil {
+				continue
+			}
+			for _, c := range kind.candidates(h, *r) {
+				if f.update(kind, c, r == newer, now) && !slices.Contains(beaten, kind.Name) {
+					beaten = append(beaten, kind.Name)
+				}
+			}
+		}
+	}
+	beaten = append(beaten, h.updateDistance(f, now)...)
+
+	for _, source := range []string{"steps", "floors", "heart_rate", "active_minutes", "distance"} {
+		if fetched, ok := h.Fetched[source]; ok {
+			f.Checked[source] = fetched
+		}
+	}
+	f.UpdatedAt = now
+	return beaten
+}
+
+// unchecked returns the dates of source downloaded since the last update: the history
+// filled in before the checked dates and the days from the last checked day on, nil
+// when there are none
+func (f *RecordFile) unchecked(h *History, source string) (older, newer *DateRange) {
+	fetched, ok := h.Fetched[source]
+	if !ok {
+		return nil, nil
+	}
+	checked, ok := f.Checked[source]
+	if !ok {
+		return &fetched, nil
+	}
+	if fetched.From.Before(checked.From) {
+		older = &DateRange{From: fetched.From, To: checked.From.AddDate(0, 0, -1)}
+	}
+	if !fetched.To.Before(checked.To) {
+		newer = &DateRange{From: checked.To, To: fetched.To}
+	}
+	return older, newer
+}
+
+// update holds candidate c against the record of kind and reports whether it beat an
+// earlier record. Records are only marked as set now when mark is true.
+func (f *RecordFile) update(kind RecordKind, c dailyValue, mark bool, now time.Time) bool {
+	current, ok := f.Records[kind.Name]
+	date := c.Date.Format(time.DateOnly)
+	switch {
+	case !ok:
+		f.Records[kind.Name] = Record{Value: c.Value, Date: date}
+	case current.Date == date:
+		// The same day, week or streak synced again, it keeps when it was set
+		if kind.better(c.Value, current.Value) {
+			current.Value = c.Value
+			f.Records[kind.Name] = current
+		}
+	case kind.better(c.Value, current.Value):
+		record := Record{Value: c.Value, Date: date}
+		if mark {
+			record.SetAt, record.Previous = now, current.Value
+			// Beaten again by a later day of the same update, the record before it counts
+			if current.SetAt.Equal(now) {
+				record.Previous = current.Previous
+			}
+		}
+		f.Records[kind.Name] = record
+		return mark
+	}
+	return false
+}
+
+// updateDistance adds the distance of the days downloaded since the last update to the
+// lifetime distance and returns the milestones newly reached. History filled in before
+// the checked dates changes every total, the distance is added up again from the start.
+func (h *History) updateDistance(f *RecordFile, now time.Time) []string {
+	older, newer := f.unchecked(h, "distance")
+	if older != nil {
+		fetched := h.Fetched["distance"]
+		newer = &fetched
+		f.DistanceBefore = 0
+	}
+	if newer == nil {
+		return nil
+	}
+	mark := older == nil && f.Checked["distance"] != (DateRange{})
+	reached := make(map[int]Milestone, len(f.Milestones))
+	for _, m := range f.Milestones {
+		reached[m.Km] = m
+	}
+	if older != nil {
+		f.Milestones = nil
+	}
+
+	var names []string
+	distance := f.DistanceBefore
+	for date := newer.From; !date.After(newer.To); date = date.AddDate(0, 0, 1) {
+		meters := h.Days[date.Format(time.DateOnly)].DistanceMeters
+		if date.Before(newer.To) {
+			f.DistanceBefore += meters
+		}
+		distance += meters
+		for _, km := range DistanceMilestones {
+			if distance < km*1000 || f.reached(km) {
+				continue
+			}
+			milestone := Milestone{Km: km, Date: date.Format(time.DateOnly), SetAt: reached[km].SetAt}
+			if _, ok := reached[km]; !ok && mark {
+				milestone.SetAt = now
+				names = append(names, strconv.Itoa(km)+" km")
+			}
+			f.Milestones = append(f.Milestones, milestone)
+		}
+	}
+	f.Distance = distance
+	return names
+}
+
+// better reports whether value beats the record
+func (k RecordKind) better(value, record int) bool {
+	if k.Lowest {
+		return value < record
+	}
+	return value > record
+}
+
+// reached reports whether the milestone of km was reached
+func (f RecordFile) reached(km int) bool {
+	for _, m := range f.Milestones {
+		if m.Km == km {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// SleepLogList is the answer of the sleep log range endpoint
+type SleepLogList struct {
+	Sleep []struct {
+		DateOfSleep   string `json:"dateOfSleep"`
+		MinutesAsleep int    `json:"minutesAsleep"`
+		IsMainSleep   bool   `json:"isMainSleep"`
+	} `json:"sleep"`
+}
+
+// DownloadSleep downloads the sleep logs of r
+func (fd *FitbitDownloader) DownloadSleep(r DateRange) (*SleepLogList, error) {
+	startDate := r.From.Format(time.DateOnly)
+	endDate := r.To.Format(time.DateOnly)
+	slog.Info("Downloading sleep data", "from", startDate, "to", endDate)
+
+	endpoint := fmt.Sprintf("https://api.fitbit.com/1.2/user/-/sleep/date/%s/%s.json", startDate, endDate)
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for %s: %v", endpoint, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+fd.TokenInfo.AccessToken)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request for %s failed: %v", endpoint, err)
+	}
+	defer resp.Body.Close()
+	fd.recordQuota(resp)
+
+	if resp.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to download sleep data: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var data SleepLogList
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse sleep JSON: %v", err)
+	}
+	slog.Debug("Sleep data downloaded", "logs", len(data.Sleep))
+	return &data, nil
+}
+
+// mergeSleep stores the minutes asleep of every day of r, naps included. Days of r
+// without a log are cleared, a log may have been deleted since the last sync.
+func (h *History) mergeSleep(data *SleepLogList, r DateRange) {
+	asleep := map[string]int{}
+	for _, log := range data.Sleep {
+		asleep[log.DateOfSleep] += log.MinutesAsleep
+	}
+	for date := r.From; !date.After(r.To); date = date.AddDate(0, 0, 1) {
+		minutes := asleep[date.Format(time.DateOnly)]
+		if _, ok := h.Days[date.Format(time.DateOnly)]; !ok && minutes == 0 {
+			continue
+		}
+		h.update(date, func(day *DayRecord) {
+			day.SleepMinutes = minutes
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Summary describes the daily values of a metric over a date range
+type Summary struct {
+	Metric string    `json:"metric"`
+	Unit   string    `json:"unit"`
+	Range  DateRange `json:"range"`
+	// Days counts the days with data, the other fields are zero without any
+	Days    int     `json:"days"`
+	Mean    float64 `json:"mean"`
+	Median  float64 `json:"median"`
+	StdDev  float64 `json:"std_dev"`
+	Min     int     `json:"min"`
+	MinDate string  `json:"min_date,omitempty"`
+	Max     int     `json:"max"`
+	MaxDate string  `json:"max_date,omitempty"`
+	// Goal is the daily goal of the metric and GoalPercent the share of days reaching it
+	Goal        int     `json:"goal,omitempty"`
+	GoalPercent float64 `json:"goal_percent,omitempty"`
+	// Slope is the change per day of a least squares line through the values
+	Slope float64 `json:"slope_per_day"`
+	// PreviousMean is the mean over the same number of days right before Range,
+	// Change its change in percent, only meaningful when Comparable
+	PreviousMean float64 `json:"previous_mean"`
+	Change       float64 `json:"change_percent"`
+	Comparable   bool    `json:"comparable"`
+}
+
+// Summarize describes m over r, counting the days reaching goal when it is set
+func (h *History) Summarize(m DailyMetric, r DateRange, goal int) Summary {
+	s := Summary{Metric: m.Name, Unit: m.Unit, Range: r}
+	days := h.daily(m, r)
+	if len(days) > 0 {
+		values := make([]int, len(days))
+		minDay, maxDay := days[0], days[0]
+		reached := 0
+		for i, d := range days {
+			values[i] = d.Value
+			if d.Value < minDay.Value {
+				minDay = d
+			}
+			if d.Value > maxDay.Value {
+				maxDay = d
+			}
+			if goal > 0 && d.Value >= goal {
+				reached++
+			}
+		}
+		s.Days = len(days)
+		s.Mean = mean(values)
+		s.Median = median(values)
+		s.StdDev = stdDev(values, s.Mean)
+		s.Min, s.MinDate = minDay.Value, minDay.Date.Format(time.DateOnly)
+		s.Max, s.MaxDate = maxDay.Value, maxDay.Date.Format(time.DateOnly)
+		if goal > 0 {
+			s.Goal = goal
+			s.GoalPercent = float64(reached) / float64(len(days)) * 100
+		}
+		s.Slope = slope(r.From, days)
+	}
+
+	s.PreviousMean = mean(h.values(m, ComparePrevious.Range(r)))
+	if s.Days > 0 && s.PreviousMean != 0 {
+		s.Change = (s.Mean - s.PreviousMean) / s.PreviousMean * 100
+		s.Comparable = true
+	}
+	return s
+}
+
+// Summaries describes every daily metric over r with the goals of goals
+func (s *DataStore) Summaries(r DateRange, goals Goals) map[string]Summary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	summaries := make(map[string]Summary, len(DailyMetrics))
+	for _, m := range DailyMetrics {
+		summaries[m.Name] = s.History.Summarize(m, r, goals[m.Name])
+	}
+	return summaries
+}
+
+// median returns the middle of values, the mean of the two middle ones for an even count
+func median(values []int) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return float64(sorted[mid])
+	}
+	return float64(sorted[mid-1]+sorted[mid]) / 2
+}
+
+// stdDev returns the population standard deviation of values around mean
+func stdDev(values []int, mean float64) float64 {
+	var squares float64
+	for _, v := range values {
+		squares += (float64(v) - mean) * (float64(v) - mean)
+	}
+	return math.Sqrt(squares / float64(len(values)))
+}
+
+// slope fits a least squares line through days, x being the days since from
+func slope(from time.Time, days []dailyValue) float64 {
+	if len(days) < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, d := range days {
+		x := d.Date.Sub(from).Hours() / 24
+		y := float64(d.Value)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(days))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// ShortDate formats a 2006-01-02 date such as the MinDate of a Summary as "Jan 2"
+func ShortDate(date string) string {
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		return date
+	}
+	return t.Format("Jan 2")
+}
@@ -0,0 +1,239 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenRefreshWindow is how long before expiry an access token gets refreshed
+const tokenRefreshWindow = 5 * time.Minute
+
+// ErrInvalidGrant is returned when Fitbit rejects the refresh token because the grant was revoked
+var ErrInvalidGrant = errors.New("refresh token is invalid or revoked")
+
+// ErrNoToken is returned when no token is stored, the account was never authorized or was disconnected
+var ErrNoToken = errors.New("token file does not exist")
+
+// TokenManager serializes access to the token of one data directory.
+// Fitbit refresh tokens are single use, so two concurrent refreshes would lock us out.
+type TokenManager struct {
+	mu      sync.Mutex
+	dataDir string
+	revoked bool // Fitbit rejected the stored refresh token
+}
+
+var (
+	tokenManagersMu sync.Mutex
+	tokenManagers   = map[string]*TokenManager{}
+)
+
+// tokenManager returns the shared manager for a data directory
+func tokenManager(dataDir string) *TokenManager {
+	tokenManagersMu.Lock()
+	defer tokenManagersMu.Unlock()
+
+	tm, ok := tokenManagers[dataDir]
+	if !ok {
+		tm = &TokenManager{dataDir: dataDir}
+		tokenManagers[dataDir] = tm
+	}
+	return tm
+}
+
+// fitbitErrorResponse is the error body returned by the Fitbit OAuth endpoints
+type fitbitErrorResponse struct {
+	Errors []struct {
+		ErrorType string `json:"errorType"`
+		Message   string `json:"message"`
+	} `json:"errors"`
+}
+
+// Token returns a usable token, refreshing it when it is about to expire.
+// The token file is re-read on every call so a refresh done by another goroutine is picked up.
+func (tm *TokenManager) Token(config Config) (TokenInfo, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	token, err := tm.load()
+	if err != nil {
+		return TokenInfo{}, err
+	}
+
+	if time.Until(token.ExpiresAt) > tokenRefreshWindow {
+		return token, nil
+	}
+
+	slog.Info("Access token expires soon, refreshing", "expires", token.ExpiresAt)
+	token, err = tm.refresh(config, token)
+	if errors.Is(err, ErrInvalidGrant) {
+		tm.revoked = true
+	}
+	if err != nil {
+		return TokenInfo{}, err
+	}
+	slog.Info("Refreshed access token")
+	return token, nil
+}
+
+// LoadToken reads the stored token of dataDir without refreshing it
+func LoadToken(dataDir string) (TokenInfo, error) {
+	tm := tokenManager(dataDir)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.load()
+}
+
+// TokenRevoked reports whether Fitbit rejected the stored refresh token of dataDir
+// since the process started, which means the account has to be authorized again
+func TokenRevoked(dataDir string) bool {
+	tm := tokenManager(dataDir)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	return tm.revoked
+}
+
+// Save atomically stores a new token
+func (tm *TokenManager) Save(token TokenInfo) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	tm.revoked = false
+	return tm.save(token)
+}
+
+// Remove deletes the stored token
+func (tm *TokenManager) Remove() error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	err := os.Remove(tm.tokenFile())
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (tm *TokenManager) tokenFile() string {
+	return filepath.Join(tm.dataDir, "token_info.json")
+}
+
+func (tm *TokenManager) load() (TokenInfo, error) {
+	var token TokenInfo
+	tokenData, err := os.ReadFile(tm.tokenFile())
+	if os.IsNotExist(err) {
+		return token, ErrNoToken
+	}
+	if err != nil {
+		return token, err
+	}
+	err = json.Unmarshal(tokenData, &token)
+	return token, err
+}
+
+func (tm *TokenManager) save(token TokenInfo) error {
+	tokenData, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(tm.tokenFile(), tokenData, 0600)
+}
+
+// refresh exchanges the refresh token for a new token pair and stores it before returning it
+func (tm *TokenManager) refresh(config Config, token TokenInfo) (TokenInfo, error) {
+	tokenURL := "https://api.fitbit.com/oauth2/token"
+	data := url.Values{}
+	data.Set("grant_type", "refresh_token")
+	data.Set("refresh_token", token.RefreshToken)
+
+	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(data.Encode()))
+	if err != nil {
+		return token, fmt.Errorf("failed to create refresh token request: %v", err)
+	}
+
+	authValue := base64.StdEncoding.EncodeToString([]byte(config.ClientID + ":" + config.ClientSecret))
+	req.Header.Set("Authorization", "Basic "+authValue)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The old refresh token stays valid for a retry, Fitbit replays the same response for a short while
+		return token, fmt.Errorf("refresh token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return token, fmt.Errorf("failed to read refresh token response: %v", err)
+	}
+
+	if resp.StatusCode == 429 {
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return token, &RateLimitError{RetryAfter: retryAfter, Message: string(bodyBytes)}
+	}
+
+	if resp.StatusCode != 200 {
+		var errResp fitbitErrorResponse
+		if json.Unmarshal(bodyBytes, &errResp) == nil {
+			for _, e := range errResp.Errors {
+				if e.ErrorType == "invalid_grant" {
+					return token, fmt.Errorf("%w: %s", ErrInvalidGrant, e.Message)
+				}
+			}
+		}
+		return token, fmt.Errorf("failed to refresh access token: %d %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	var tokenResp TokenResponse
+	err = json.Unmarshal(bodyBytes, &tokenResp)
+	if err != nil {
+		return token, fmt.Errorf("failed to decode refresh token response: %v", err)
+	}
+
+	token.AccessToken = tokenResp.AccessToken
+	token.RefreshToken = tokenResp.RefreshToken
+	token.ExpiresAt = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+
+	// The previous refresh token is now spent, so the new one must be on disk before it is used
+	err = tm.save(token)
+	if err != nil {
+		return token, fmt.Errorf("failed to save updated token information: %v", err)
+	}
+	return token, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
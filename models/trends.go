@@ -0,0 +1,161 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// Smoothers that can be drawn over daily charts
+const (
+	SmootherEMA   = "ema"
+	SmootherLOESS = "loess"
+)
+
+const (
+	// emaSpan is the span in days of the exponential moving average
+	emaSpan = 10
+	// loessBandwidth is the share of the points each LOESS fit looks at
+	loessBandwidth = 0.3
+)
+
+// noData marks the points of an overlay without enough data to draw, 0 is a real average
+var noData = math.NaN()
+
+// trendOverlays draws the configured rolling averages and smoother of m over the points of
+// a daily chart. Windows reach back before r so the first points average full windows.
+func (h *History) trendOverlays(m DailyMetric, r DateRange, buckets []bucket) map[string][]float64 {
+	if len(buckets) == 0 || (len(settings.RollingAverages) == 0 && settings.Smoother == "") {
+		return nil
+	}
+	lookback := emaSpan * 3
+	for _, window := range settings.RollingAverages {
+		lookback = max(lookback, window)
+	}
+	values := map[time.Time]int{}
+	for _, d := range h.daily(m, DateRange{From: r.From.AddDate(0, 0, -lookback), To: r.To}) {
+		values[d.Date] = d.Value
+	}
+
+	overlays := map[string][]float64{}
+	for _, window := range settings.RollingAverages {
+		overlays[fmt.Sprintf("%d-day average", window)] = rollingMean(values, buckets, window)
+	}
+	switch settings.Smoother {
+	case SmootherEMA:
+		overlays["EMA"] = ema(values, r.From.AddDate(0, 0, -lookback), buckets)
+	case SmootherLOESS:
+		overlays["LOESS"] = loess(values, buckets)
+	}
+	return overlays
+}
+
+// rollingMean averages the values of the window days ending on each point, points without
+// a value in their window are noData
+func rollingMean(values map[time.Time]int, buckets []bucket, window int) []float64 {
+	out := make([]float64, len(buckets))
+	for i, b := range buckets {
+		out[i] = noData
+		total, count := 0, 0
+		for date := b.start.AddDate(0, 0, -(window - 1)); !date.After(b.start); date = date.AddDate(0, 0, 1) {
+			if v, ok := values[date]; ok {
+				total += v
+				count++
+			}
+		}
+		if count > 0 {
+			out[i] = round1(float64(total) / float64(count))
+		}
+	}
+	return out
+}
+
+// ema runs an exponential moving average over the values from start, days without a
+// value keep the average unchanged and points before the first value are noData
+func ema(values map[time.Time]int, start time.Time, buckets []bucket) []float64 {
+	alpha := 2.0 / (emaSpan + 1)
+	out := make([]float64, len(buckets))
+	var average float64
+	seeded := false
+	i := 0
+	for date := start; i < len(buckets); date = date.AddDate(0, 0, 1) {
+		if v, ok := values[date]; ok {
+			if !seeded {
+				average, seeded = float64(v), true
+			}
+			average = alpha*float64(v) + (1-alpha)*average
+		}
+		if date.Equal(buckets[i].start) {
+			out[i] = noData
+			if seeded {
+				out[i] = round1(average)
+			}
+			i++
+		}
+	}
+	return out
+}
+
+// loess fits a line around each point through its nearest neighbours, weighted by the
+// tricube of their distance, and returns the fitted values, noData where no fit is possible
+func loess(values map[time.Time]int, buckets []bucket) []float64 {
+	var xs, ys []float64
+	for _, b := range buckets {
+		if v, ok := values[b.start]; ok {
+			xs = append(xs, float64(b.start.Unix()/86400))
+			ys = append(ys, float64(v))
+		}
+	}
+	out := make([]float64, len(buckets))
+	for i := range out {
+		out[i] = noData
+	}
+	neighbours := max(3, int(math.Ceil(loessBandwidth*float64(len(xs)))))
+	if len(xs) < neighbours {
+		return out
+	}
+
+	distances := make([]float64, len(xs))
+	for i, b := range buckets {
+		x := float64(b.start.Unix() / 86400)
+		for j := range xs {
+			distances[j] = math.Abs(xs[j] - x)
+		}
+		sorted := slices.Clone(distances)
+		slices.Sort(sorted)
+		reach := sorted[neighbours-1]
+		if reach == 0 {
+			reach = 1
+		}
+
+		var sw, swx, swy, swxx, swxy float64
+		for j := range xs {
+			d := distances[j] / reach
+			if d >= 1 {
+				continue
+			}
+			w := math.Pow(1-d*d*d, 3)
+			sw += w
+			swx += w * xs[j]
+			swy += w * ys[j]
+			swxx += w * xs[j] * xs[j]
+			swxy += w * xs[j] * ys[j]
+		}
+		if sw == 0 {
+			continue
+		}
+		fit := swy / sw
+		if denominator := sw*swxx - swx*swx; denominator != 0 {
+			slope := (sw*swxy - swx*swy) / denominator
+			fit = (swy-slope*swx)/sw + slope*x
+		}
+		out[i] = round1(fit)
+	}
+	return out
+}
+
+// round1 rounds to one decimal
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
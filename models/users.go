@@ -0,0 +1,100 @@
+package models
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var userNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+var (
+	storesMu sync.Mutex
+	stores   = map[string]*DataStore{}
+)
+
+// ValidUserName reports whether name can be used as a user directory and URL segment
+func ValidUserName(name string) bool {
+	return userNamePattern.MatchString(name)
+}
+
+// UserDataDir returns the data directory of a linked Fitbit account
+func UserDataDir(baseDir, user string) string {
+	return filepath.Join(baseDir, "users", user)
+}
+
+// ListUsers returns the names of all linked Fitbit accounts in alphabetical order
+func ListUsers(baseDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(baseDir, "users"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidUserName(entry.Name()) {
+			users = append(users, entry.Name())
+		}
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+// UserExists reports whether a data directory exists for user
+func UserExists(baseDir, user string) bool {
+	if !ValidUserName(user) {
+		return false
+	}
+	info, err := os.Stat(UserDataDir(baseDir, user))
+	return err == nil && info.IsDir()
+}
+
+// StoreFor returns the in-memory data store belonging to a data directory
+func StoreFor(dataDir string) *DataStore {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	store, ok := stores[dataDir]
+	if !ok {
+		store = &DataStore{}
+		stores[dataDir] = store
+	}
+	return store
+}
+
+// MigrateLegacyDataDir moves the files of the old single-user layout into users/default
+func MigrateLegacyDataDir(baseDir string) error {
+	files := []string{"account_info.json", "token_info.json", "cache.json"}
+
+	var legacy []string
+	for _, name := range files {
+		if _, err := os.Stat(filepath.Join(baseDir, name)); err == nil {
+			legacy = append(legacy, name)
+		}
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	userDir := UserDataDir(baseDir, "default")
+	err := os.MkdirAll(userDir, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create user directory: %w", err)
+	}
+
+	for _, name := range legacy {
+		err := os.Rename(filepath.Join(baseDir, name), filepath.Join(userDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to move %s: %w", name, err)
+		}
+	}
+	slog.Info("Migrated legacy data directory", "files", legacy, "dir", userDir)
+	return nil
+}
@@ -0,0 +1,190 @@
+// Package notify delivers the notifications of the rules evaluated after every sync
+// through the channels set up in the config, and always to the dashboard inbox.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofit/config"
+	"github.com/gofit/mail"
+	"github.com/gofit/models"
+)
+
+// Channel delivers notifications to one destination
+type Channel interface {
+	Name() string
+	// Send delivers n, which fired for the account of dataDir
+	Send(dataDir string, n models.Notification) error
+}
+
+// channels are the destinations of notifications, set with Configure
+var channels = []Channel{inbox{}}
+
+// Configure sets up the channels of cfg next to the inbox
+func Configure(cfg config.NotifyConfig, smtp config.SMTPConfig) {
+	channels = []Channel{inbox{}}
+	if cfg.WebhookURL != "" {
+		channels = append(channels, webhook{url: cfg.WebhookURL})
+	}
+	if cfg.PushURL != "" {
+		channels = append(channels, push{url: cfg.PushURL, token: cfg.PushToken, gotify: cfg.PushFormat == "gotify"})
+	}
+	if cfg.EmailTo != "" {
+		channels = append(channels, email{smtp: smtp, to: cfg.EmailTo})
+	}
+}
+
+// AfterSync evaluates the rules of dataDir after a sync that ended with syncErr and sends
+// the notifications of the rules that fired
+func AfterSync(dataDir string, syncErr error) {
+	fired, err := models.EvaluateRules(dataDir, syncErr, time.Now())
+	if err != nil {
+		slog.Error("Failed to evaluate notification rules", "dir", dataDir, "err", err)
+		return
+	}
+	for _, n := range fired {
+		slog.Info("Notification rule fired", "dir", dataDir, "rule", n.Rule, "title", n.Title)
+		Send(dataDir, n)
+	}
+}
+
+// Send delivers n through every channel and returns the errors of the channels that failed
+func Send(dataDir string, n models.Notification) map[string]error {
+	failed := map[string]error{}
+	for _, c := range channels {
+		if err := c.Send(dataDir, n); err != nil {
+			slog.Error("Failed to send notification", "channel", c.Name(), "dir", dataDir, "err", err)
+			failed[c.Name()] = err
+		}
+	}
+	return failed
+}
+
+// Channels names the channels notifications are sent through
+func Channels() []string {
+	names := make([]string, len(channels))
+	for i, c := range channels {
+		names[i] = c.Name()
+	}
+	return names
+}
+
+// account names the account of dataDir in messages leaving the dashboard
+func account(dataDir string) string {
+	return filepath.Base(dataDir)
+}
+
+// client sends the HTTP notifications, a stalled server must not hold up the sync
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// post sends req and fails on any answer but a 2xx
+func post(req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may carry a token, only the host is worth logging
+		return fmt.Errorf("request to %s failed", req.URL.Host)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s answered %d %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// inbox keeps notifications for the dashboard
+type inbox struct{}
+
+func (inbox) Name() string { return "inbox" }
+
+func (inbox) Send(dataDir string, n models.Notification) error {
+	return models.AddToInbox(dataDir, []models.Notification{n})
+}
+
+// webhook posts notifications as JSON to a URL
+type webhook struct {
+	url string
+}
+
+func (webhook) Name() string { return "webhook" }
+
+// webhookPayload is the JSON body posted to the webhook
+type webhookPayload struct {
+	Account string    `json:"account"`
+	Rule    int       `json:"rule"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+func (c webhook) Send(dataDir string, n models.Notification) error {
+	body, err := json.Marshal(webhookPayload{Account: account(dataDir), Rule: n.Rule, Title: n.Title, Message: n.Message, At: n.At})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(req)
+}
+
+// push sends notifications to an ntfy topic or a Gotify server
+type push struct {
+	url    string
+	token  string
+	gotify bool
+}
+
+func (push) Name() string { return "push" }
+
+func (c push) Send(dataDir string, n models.Notification) error {
+	title := account(dataDir) + ": " + n.Title
+	var req *http.Request
+	var err error
+	if c.gotify {
+		body, _ := json.Marshal(map[string]any{"title": title, "message": n.Message, "priority": 5})
+		req, err = http.NewRequest("POST", c.url, bytes.NewReader(body))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gotify-Key", c.token)
+		}
+	} else {
+		// ntfy takes the message as the body and the rest as headers
+		req, err = http.NewRequest("POST", c.url, strings.NewReader(n.Message))
+		if err == nil {
+			req.Header.Set("Title", title)
+			req.Header.Set("Tags", "gofit")
+			if c.token != "" {
+				req.Header.Set("Authorization", "Bearer "+c.token)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create push request: %w", err)
+	}
+	return post(req)
+}
+
+// email sends notifications through the SMTP server
+type email struct {
+	smtp config.SMTPConfig
+	to   string
+}
+
+func (email) Name() string { return "email" }
+
+func (c email) Send(dataDir string, n models.Notification) error {
+	body := fmt.Sprintf("<p><strong>%s</strong></p><p>%s</p>", html.EscapeString(n.Title), html.EscapeString(n.Message))
+	return mail.Send(c.smtp, c.to, "[gofit] "+account(dataDir)+": "+n.Title, body)
+}
@@ -0,0 +1,189 @@
+package notify
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofit/config"
+	"github.com/gofit/mail/mailtest"
+	"github.com/gofit/models"
+)
+
+// request is what a test HTTP server received
+type request struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// newHookServer starts an HTTP server that keeps the requests it receives and
+// answers 500 on /fail
+func newHookServer(t *testing.T) (*httptest.Server, func() []request) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = append(received, request{path: r.URL.Path, header: r.Header, body: string(body)})
+		mu.Unlock()
+		if r.URL.Path == "/fail" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), received...)
+	}
+}
+
+// configure sets up the channels of cfg for the test and only the inbox after it
+func configure(t *testing.T, cfg config.NotifyConfig, smtp config.SMTPConfig) {
+	t.Helper()
+	Configure(cfg, smtp)
+	t.Cleanup(func() { Configure(config.NotifyConfig{}, config.SMTPConfig{}) })
+}
+
+// testNotification is sent for the account "alice"
+var testNotification = models.Notification{
+	Rule:    3,
+	Title:   "Steps below 5000 by 18:00",
+	Message: "1200 steps so far today, 3800 to go.",
+	At:      time.Date(2025, 10, 15, 18, 0, 0, 0, time.UTC),
+}
+
+// accountDir creates the data directory of the account alice
+func accountDir(t *testing.T) string {
+	t.Helper()
+	dataDir := filepath.Join(t.TempDir(), "alice")
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dataDir
+}
+
+func TestWebhook(t *testing.T) {
+	server, received := newHookServer(t)
+	configure(t, config.NotifyConfig{WebhookURL: server.URL + "/hook"}, config.SMTPConfig{})
+
+	if failed := Send(accountDir(t), testNotification); len(failed) > 0 {
+		t.Fatalf("Send failed: %v", failed)
+	}
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+	if got := requests[0].header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("content type %q", got)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal([]byte(requests[0].body), &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	want := webhookPayload{Account: "alice", Rule: 3, Title: testNotification.Title, Message: testNotification.Message, At: testNotification.At}
+	if payload != want {
+		t.Errorf("payload %+v, want %+v", payload, want)
+	}
+}
+
+func TestNtfy(t *testing.T) {
+	server, received := newHookServer(t)
+	configure(t, config.NotifyConfig{PushURL: server.URL + "/gofit", PushToken: "tk_secret"}, config.SMTPConfig{})
+
+	if failed := Send(accountDir(t), testNotification); len(failed) > 0 {
+		t.Fatalf("Send failed: %v", failed)
+	}
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+	r := requests[0]
+	if r.path != "/gofit" || r.body != testNotification.Message {
+		t.Errorf("posted %q to %s", r.body, r.path)
+	}
+	if got := r.header.Get("Title"); got != "alice: "+testNotification.Title {
+		t.Errorf("title %q", got)
+	}
+	if got := r.header.Get("Authorization"); got != "Bearer tk_secret" {
+		t.Errorf("authorization %q", got)
+	}
+}
+
+func TestGotify(t *testing.T) {
+	server, received := newHookServer(t)
+	configure(t, config.NotifyConfig{PushURL: server.URL + "/message", PushFormat: "gotify", PushToken: "app-token"}, config.SMTPConfig{})
+
+	if failed := Send(accountDir(t), testNotification); len(failed) > 0 {
+		t.Fatalf("Send failed: %v", failed)
+	}
+	requests := received()
+	if len(requests) != 1 {
+		t.Fatalf("server received %d requests, want 1", len(requests))
+	}
+	if got := requests[0].header.Get("X-Gotify-Key"); got != "app-token" {
+		t.Errorf("app token %q", got)
+	}
+	var message struct {
+		Title    string `json:"title"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+	}
+	if err := json.Unmarshal([]byte(requests[0].body), &message); err != nil {
+		t.Fatalf("message is not JSON: %v", err)
+	}
+	if message.Title != "alice: "+testNotification.Title || message.Message != testNotification.Message {
+		t.Errorf("message %+v", message)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	server := mailtest.NewServer(t)
+	configure(t, config.NotifyConfig{EmailTo: "me@example.com"}, server.Config("gofit@example.com"))
+
+	if failed := Send(accountDir(t), testNotification); len(failed) > 0 {
+		t.Fatalf("Send failed: %v", failed)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d emails, want 1", len(messages))
+	}
+	if got := messages[0].To; len(got) != 1 || got[0] != "me@example.com" {
+		t.Errorf("sent to %v", got)
+	}
+	if !strings.Contains(messages[0].Data, "Subject: [gofit] alice: Steps below 5000 by 18:00") {
+		t.Errorf("email lacks the subject:\n%s", messages[0].Data)
+	}
+}
+
+func TestSendReportsFailedChannels(t *testing.T) {
+	server, _ := newHookServer(t)
+	configure(t, config.NotifyConfig{WebhookURL: server.URL + "/fail", PushURL: server.URL + "/gofit"}, config.SMTPConfig{})
+	dataDir := accountDir(t)
+
+	failed := Send(dataDir, testNotification)
+	if len(failed) != 1 || failed["webhook"] == nil {
+		t.Fatalf("failed channels %v, want only the webhook", failed)
+	}
+	if !strings.Contains(failed["webhook"].Error(), "500") {
+		t.Errorf("error %q does not name the status", failed["webhook"])
+	}
+
+	// The inbox keeps the notification whatever the other channels did
+	f, err := models.LoadNotifications(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Inbox) != 1 || f.Inbox[0].Title != testNotification.Title {
+		t.Errorf("inbox %+v, want the notification", f.Inbox)
+	}
+}
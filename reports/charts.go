@@ -0,0 +1,390 @@
+package reports
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// Size of a report chart in pixels, and the margins kept for the axis labels of the SVG
+const (
+	chartWidth  = 720
+	chartHeight = 240
+	marginLeft  = 56
+	marginRight = 12
+	marginTop   = 12
+	marginBelow = 40
+	// maxXLabels is the number of dates written under a chart at most
+	maxXLabels = 10
+	goalColour = "#7f8c8d"
+	// gridLines is the number of steps of the y axis
+	gridLines = 4
+)
+
+// staticChart is a chart of a report drawn on the server, as SVG in the saved page and as
+// PNG in emails, so neither needs scripts
+type staticChart struct {
+	title  string
+	unit   string
+	labels []string
+	series []chartSeries
+	// stacked draws the series as stacked bars, otherwise the first series is drawn as
+	// bars and the others as lines over them
+	stacked bool
+	// line draws a single series as a line instead of bars
+	line bool
+	goal int
+}
+
+// chartSeries is one named series of a chart, NaN values are gaps
+type chartSeries struct {
+	name   string
+	colour string // #rrggbb
+	values []float64
+}
+
+// reportCharts picks the charts of a report from a daily view of its period
+func reportCharts(view models.StoreView) []staticChart {
+	var out []staticChart
+	for _, c := range []struct {
+		title, unit, colour string
+		data                models.ChartData
+	}{
+		{"Steps", "steps", "#3498db", view.Steps},
+		{"Active minutes", "min", "#27ae60", view.ActiveMinutes},
+	} {
+		if len(c.data.XAxis) == 0 {
+			continue
+		}
+		chart := staticChart{title: c.title, unit: c.unit, labels: c.data.XAxis, goal: c.data.Goal}
+		for _, values := range c.data.Series {
+			chart.series = append(chart.series, chartSeries{name: c.title, colour: c.colour, values: floats(values)})
+		}
+		out = append(out, chart)
+	}
+
+	hr := view.HeartRate
+	entries := hr.Series["Heart Rate"]
+	if len(hr.XAxis) == 0 || len(entries) == 0 {
+		return out
+	}
+	zones := staticChart{title: "Heart rate zones", unit: "min", labels: hr.XAxis, stacked: true}
+	for _, z := range []struct{ zone, colour string }{{"Fat Burn", "#f1c40f"}, {"Cardio", "#e67e22"}, {"Peak", "#c0392b"}} {
+		s := chartSeries{name: z.zone, colour: z.colour, values: make([]float64, len(entries))}
+		for i, e := range entries {
+			s.values[i] = float64(e.Zones[z.zone])
+		}
+		zones.series = append(zones.series, s)
+	}
+	resting := staticChart{title: "Resting heart rate", unit: "bpm", labels: hr.XAxis, line: true}
+	s := chartSeries{name: "Resting heart rate", colour: "#8e44ad", values: make([]float64, len(entries))}
+	for i, e := range entries {
+		// Days without a reading report 0
+		s.values[i] = math.NaN()
+		if e.RestingRate > 0 {
+			s.values[i] = float64(e.RestingRate)
+		}
+	}
+	resting.series = append(resting.series, s)
+	return append(out, zones, resting)
+}
+
+func floats(values []int) []float64 {
+	out := make([]float64, len(values))
+	for i, v := range values {
+		out[i] = float64(v)
+	}
+	return out
+}
+
+// empty reports whether the chart has no value to draw
+func (c staticChart) empty() bool {
+	for _, s := range c.series {
+		for _, v := range s.values {
+			if !math.IsNaN(v) && v != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// caption returns the legend and the scale written under the PNG of the chart
+func (c staticChart) caption() ([]templates.ChartLegend, string) {
+	var legend []templates.ChartLegend
+	for _, s := range c.series {
+		legend = append(legend, templates.ChartLegend{Name: s.name, Colour: s.colour})
+	}
+	if c.goal > 0 {
+		legend = append(legend, templates.ChartLegend{Name: fmt.Sprintf("Goal %d", c.goal), Colour: goalColour})
+	}
+	low, high := c.bounds()
+	scale := fmt.Sprintf("%s to %s %s", formatTick(low), formatTick(high), c.unit)
+	if len(c.labels) > 0 {
+		scale += fmt.Sprintf(", %s to %s", c.labels[0], c.labels[len(c.labels)-1])
+	}
+	return legend, scale
+}
+
+// bounds returns the range of the y axis, from 0 for bars and around the values for lines
+func (c staticChart) bounds() (float64, float64) {
+	low, high := math.Inf(1), 0.0
+	for i := range c.labels {
+		total := 0.0
+		for _, s := range c.series {
+			v := s.values[i]
+			if math.IsNaN(v) {
+				continue
+			}
+			low = math.Min(low, v)
+			if c.stacked {
+				total += v
+			} else {
+				high = math.Max(high, v)
+			}
+		}
+		high = math.Max(high, total)
+	}
+	high = math.Max(high, float64(c.goal))
+	if !c.line || math.IsInf(low, 1) {
+		low, high = 0, niceCeil(high)
+	} else {
+		// Lines only span their values, so a change of a few beats shows. Each grid step
+		// is a multiple of 5.
+		low = math.Floor(low*0.9/5) * 5
+		high = low + math.Ceil((high*1.1-low)/(5*gridLines))*5*gridLines
+	}
+	if high <= low {
+		high = low + 1
+	}
+	return low, high
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	step := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, f := range []float64{1, 2, 5, 10} {
+		if f*step >= v {
+			return f * step
+		}
+	}
+	return 10 * step
+}
+
+// plot maps the chart onto a width by height area
+type plot struct {
+	chart          staticChart
+	left, top      float64
+	width, height  float64
+	low, high      float64
+	slot, barWidth float64
+	labelEvery     int
+}
+
+func newPlot(c staticChart, left, top, width, height float64) plot {
+	low, high := c.bounds()
+	slot := width / float64(len(c.labels))
+	return plot{
+		chart: c, left: left, top: top, width: width, height: height,
+		low: low, high: high, slot: slot, barWidth: math.Max(1, slot*0.7),
+		labelEvery: max(1, (len(c.labels)+maxXLabels-1)/maxXLabels),
+	}
+}
+
+// x returns the centre of the slot of point i
+func (p plot) x(i int) float64 {
+	return p.left + p.slot*(float64(i)+0.5)
+}
+
+// y returns the position of value v
+func (p plot) y(v float64) float64 {
+	return p.top + p.height - (v-p.low)/(p.high-p.low)*p.height
+}
+
+// bar is one rectangle of a bar chart
+type bar struct {
+	x, y, w, h float64
+	colour     string
+}
+
+// bars returns the rectangles of the bar series
+func (p plot) bars() []bar {
+	var out []bar
+	if p.chart.line {
+		return nil
+	}
+	series := p.chart.series
+	if !p.chart.stacked {
+		series = series[:1]
+	}
+	for i := range p.chart.labels {
+		base := p.low
+		for _, s := range series {
+			v := s.values[i]
+			if math.IsNaN(v) || v <= 0 {
+				continue
+			}
+			top := base + v
+			out = append(out, bar{x: p.x(i) - p.barWidth/2, y: p.y(top), w: p.barWidth, h: p.y(base) - p.y(top), colour: s.colour})
+			if p.chart.stacked {
+				base = top
+			}
+		}
+	}
+	return out
+}
+
+// polyline is one unbroken run of a line series
+type polyline struct {
+	points [][2]float64
+	colour string
+}
+
+// lines returns the polylines of the line series, split at gaps
+func (p plot) lines() []polyline {
+	var out []polyline
+	if p.chart.stacked {
+		return nil
+	}
+	series := p.chart.series
+	if !p.chart.line {
+		series = series[1:]
+	}
+	for _, s := range series {
+		var points [][2]float64
+		flush := func() {
+			if len(points) > 0 {
+				out = append(out, polyline{points, s.colour})
+			}
+			points = nil
+		}
+		for i, v := range s.values {
+			if math.IsNaN(v) {
+				flush()
+				continue
+			}
+			points = append(points, [2]float64{p.x(i), p.y(v)})
+		}
+		flush()
+	}
+	return out
+}
+
+// svg draws the chart with its axes and labels
+func (c staticChart) svg() string {
+	p := newPlot(c, marginLeft, marginTop, chartWidth-marginLeft-marginRight, chartHeight-marginTop-marginBelow)
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="100%%" role="img" aria-label="%s" font-family="sans-serif" font-size="11">`,
+		chartWidth, chartHeight, html.EscapeString(c.title))
+
+	for i := 0; i <= gridLines; i++ {
+		v := p.low + (p.high-p.low)*float64(i)/gridLines
+		y := p.y(v)
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#ecf0f1"/>`, p.left, y, p.left+p.width, y)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end" fill="#7f8c8d">%s</text>`, p.left-6, y+4, formatTick(v))
+	}
+	for _, r := range p.bars() {
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, r.x, r.y, r.w, r.h, r.colour)
+	}
+	for _, l := range p.lines() {
+		var points []string
+		for _, pt := range l.points {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", pt[0], pt[1]))
+		}
+		fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(points, " "), l.colour)
+	}
+	if c.goal > 0 {
+		y := p.y(float64(c.goal))
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-dasharray="6 4"/>`, p.left, y, p.left+p.width, y, goalColour)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="end" fill="#7f8c8d">goal %d</text>`, p.left+p.width, y-4, c.goal)
+	}
+	for i, label := range c.labels {
+		if i%p.labelEvery == 0 {
+			fmt.Fprintf(&b, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#7f8c8d">%s</text>`, p.x(i), p.top+p.height+16, html.EscapeString(label))
+		}
+	}
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+// formatTick writes the value of a grid line of the y axis
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// png draws the chart without text, the page around it names the axes
+func (c staticChart) png() ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	fill(img, 0, 0, chartWidth, chartHeight, color.RGBA{255, 255, 255, 255})
+	p := newPlot(c, marginRight, marginTop, chartWidth-2*marginRight, chartHeight-2*marginTop)
+
+	grid := parseColour("#ecf0f1")
+	for i := 0; i <= gridLines; i++ {
+		y := p.y(p.low + (p.high-p.low)*float64(i)/gridLines)
+		fill(img, p.left, y, p.width, 1, grid)
+	}
+	for _, r := range p.bars() {
+		fill(img, r.x, r.y, r.w, r.h, parseColour(r.colour))
+	}
+	for _, l := range p.lines() {
+		colour := parseColour(l.colour)
+		for i, pt := range l.points {
+			from := pt
+			if i > 0 {
+				from = l.points[i-1]
+			}
+			segment(img, from, pt, colour)
+		}
+	}
+	if c.goal > 0 {
+		y := p.y(float64(c.goal))
+		for x := p.left; x < p.left+p.width; x += 10 {
+			fill(img, x, y, 6, 1, parseColour(goalColour))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fill paints a rectangle
+func fill(img *image.RGBA, x, y, w, h float64, c color.RGBA) {
+	for py := int(math.Round(y)); py < int(math.Round(y+h)); py++ {
+		for px := int(math.Round(x)); px < int(math.Round(x+w)); px++ {
+			img.SetRGBA(px, py, c)
+		}
+	}
+}
+
+// segment draws a line two pixels wide between two points
+func segment(img *image.RGBA, from, to [2]float64, c color.RGBA) {
+	steps := int(math.Max(math.Abs(to[0]-from[0]), math.Abs(to[1]-from[1]))) + 1
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		fill(img, from[0]+(to[0]-from[0])*t-1, from[1]+(to[1]-from[1])*t-1, 2, 2, c)
+	}
+}
+
+// parseColour reads a #rrggbb colour
+func parseColour(hex string) color.RGBA {
+	var r, g, b uint8
+	fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b)
+	return color.RGBA{r, g, b, 255}
+}
@@ -0,0 +1,270 @@
+// Package reports writes weekly and monthly summaries of an account as standalone
+// HTML pages under its data directory and emails them when a mail server is set up.
+package reports
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofit/config"
+	"github.com/gofit/mail"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// Settings configure the reports written after syncs
+type Settings struct {
+	Report config.ReportConfig
+	SMTP   config.SMTPConfig
+}
+
+// settings holds the configuration applied with Configure
+var settings Settings
+
+// Configure replaces the package settings
+func Configure(s Settings) {
+	settings = s
+}
+
+// Period is the span a report covers
+type Period string
+
+const (
+	Weekly  Period = "weekly"
+	Monthly Period = "monthly"
+)
+
+// Periods lists the reports that can be written
+var Periods = []Period{Weekly, Monthly}
+
+// ParsePeriod reads a period name
+func ParsePeriod(name string) (Period, bool) {
+	for _, p := range Periods {
+		if string(p) == name {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// Range returns the last complete period before today, a week from Monday to Sunday
+// or a calendar month
+func (p Period) Range(today time.Time) models.DateRange {
+	if p == Monthly {
+		first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return models.DateRange{From: first.AddDate(0, -1, 0), To: first.AddDate(0, 0, -1)}
+	}
+	monday := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	return models.DateRange{From: monday.AddDate(0, 0, -7), To: monday.AddDate(0, 0, -1)}
+}
+
+// title names the report of p
+func (p Period) title() string {
+	if p == Monthly {
+		return "Monthly report"
+	}
+	return "Weekly report"
+}
+
+// Path returns where the report of p over r is saved for dataDir, e.g. reports/weekly-2025-10-06.html
+func Path(dataDir string, p Period, r models.DateRange) string {
+	name := string(p) + "-" + r.From.Format(time.DateOnly)
+	if p == Monthly {
+		name = string(p) + "-" + r.From.Format("2006-01")
+	}
+	return filepath.Join(dataDir, "reports", name+".html")
+}
+
+// Write renders the report of p over r for the account of dataDir and saves it,
+// replacing an earlier one, and returns its path. Its charts are inline SVG, so the
+// page opens anywhere.
+func Write(dataDir string, p Period, r models.DateRange) (string, error) {
+	page, _, err := render(dataDir, p, r, false)
+	if err != nil {
+		return "", err
+	}
+
+	path := Path(dataDir, p, r)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create reports directory: %w", err)
+	}
+	if err := os.WriteFile(path, page, 0644); err != nil {
+		return "", fmt.Errorf("failed to write report: %w", err)
+	}
+	return path, nil
+}
+
+// Email sends the report of p over r for the account of dataDir to the configured
+// address. Mail clients drop SVG, so its charts are attached as PNG images.
+func Email(dataDir string, p Period, r models.DateRange) error {
+	if settings.Report.EmailTo == "" {
+		return fmt.Errorf("no address to email reports to, set report.email_to")
+	}
+	page, images, err := render(dataDir, p, r, true)
+	if err != nil {
+		return err
+	}
+	return mail.Send(settings.SMTP, settings.Report.EmailTo, p.title()+" "+r.String(), string(page), images...)
+}
+
+// render renders the report of p over r with its charts as SVG, or as the PNG images
+// it returns when the page is for an email
+func render(dataDir string, p Period, r models.DateRange, email bool) ([]byte, []mail.Image, error) {
+	if _, err := models.LoadDataStore(dataDir); err != nil {
+		return nil, nil, fmt.Errorf("no data to report: %w", err)
+	}
+
+	report, charts := build(dataDir, p, r)
+	var images []mail.Image
+	for i, c := range charts {
+		chart := templates.ReportChart{Title: c.title}
+		if !email {
+			chart.SVG = template.HTML(c.svg())
+			report.Charts = append(report.Charts, chart)
+			continue
+		}
+		png, err := c.png()
+		if err != nil {
+			return nil, nil, err
+		}
+		id := fmt.Sprintf("chart-%d", i+1)
+		images = append(images, mail.Image{ID: id, PNG: png})
+		chart.Image = "cid:" + id
+		chart.Legend, chart.Scale = c.caption()
+		report.Charts = append(report.Charts, chart)
+	}
+
+	var buf bytes.Buffer
+	if err := templates.ReportPage(report).Render(context.Background(), &buf); err != nil {
+		return nil, nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.Bytes(), images, nil
+}
+
+// AfterSync writes the enabled reports of the last complete week and month once, after
+// the first successful sync of the account since they ended, and emails them when an
+// address is configured
+func AfterSync(dataDir string, err error) {
+	if err != nil {
+		return
+	}
+	for p, enabled := range map[Period]bool{Weekly: settings.Report.Weekly, Monthly: settings.Report.Monthly} {
+		r := p.Range(models.Today())
+		if _, err := os.Stat(Path(dataDir, p, r)); !enabled || err == nil {
+			continue
+		}
+		path, err := Write(dataDir, p, r)
+		if err != nil {
+			slog.Error("Failed to write report", "dir", dataDir, "period", p, "err", err)
+			continue
+		}
+		slog.Info("Wrote report", "path", path)
+		if settings.Report.EmailTo == "" {
+			continue
+		}
+		if err := Email(dataDir, p, r); err != nil {
+			slog.Error("Failed to email report", "path", path, "err", err)
+			continue
+		}
+		slog.Info("Emailed report", "path", path, "to", settings.Report.EmailTo)
+	}
+}
+
+// build gathers the figures of the report of p over r, and its charts
+func build(dataDir string, p Period, r models.DateRange) (templates.Report, []staticChart) {
+	store := models.StoreFor(dataDir)
+	goalFile, err := models.LoadGoals(dataDir)
+	if err != nil {
+		slog.Warn("Failed to load goals", "dir", dataDir, "err", err)
+	}
+	goals := goalFile.Effective()
+
+	report := templates.Report{
+		Title:     p.title(),
+		Account:   store.Profile().User.FullName,
+		Range:     r.String(),
+		Generated: time.Now().Format("2006-01-02 15:04"),
+	}
+	if report.Account == "" {
+		report.Account = filepath.Base(dataDir)
+	}
+
+	summaries := store.Summaries(r, goals)
+	for _, m := range models.DailyMetrics {
+		if s := summaries[m.Name]; s.Days > 0 {
+			report.Stats = append(report.Stats, reportStat(m, s))
+		}
+	}
+
+	records, err := models.CurrentRecords(dataDir)
+	if err != nil {
+		slog.Warn("Failed to load records", "dir", dataDir, "err", err)
+	}
+	for _, kind := range models.RecordKinds {
+		record, ok := records.Records[kind.Name]
+		if !ok {
+			continue
+		}
+		report.Records = append(report.Records, templates.PersonalRecord{
+			Label: kind.Label,
+			Value: fmt.Sprintf("%d %s", record.Value, kind.Unit),
+			Date:  record.Date,
+			New:   within(record.Date, r),
+		})
+	}
+	for _, m := range records.Milestones {
+		if within(m.Date, r) {
+			report.Milestones = append(report.Milestones, templates.DistanceMilestone{Label: fmt.Sprintf("%d km", m.Km), Date: m.Date})
+		}
+	}
+
+	view := store.View(r, models.Rollup{Granularity: models.Daily, Aggregation: models.Mean})
+	view.SetGoals(goals)
+	var charts []staticChart
+	for _, c := range reportCharts(view) {
+		if !c.empty() {
+			charts = append(charts, c)
+		}
+	}
+	return report, charts
+}
+
+// reportStat formats the summary of m for the table of a report
+func reportStat(m models.DailyMetric, s models.Summary) templates.ReportStat {
+	stat := templates.ReportStat{
+		Label:  m.Label,
+		Mean:   fmt.Sprintf("%.0f %s", s.Mean, s.Unit),
+		Min:    fmt.Sprintf("%d on %s", s.Min, models.ShortDate(s.MinDate)),
+		Max:    fmt.Sprintf("%d on %s", s.Max, models.ShortDate(s.MaxDate)),
+		Change: "n/a",
+		Trend:  "flat",
+	}
+	if s.Goal > 0 {
+		stat.Goal = fmt.Sprintf("%.0f%% of days", s.GoalPercent)
+	}
+	if s.Comparable {
+		// Adding 0 turns a rounded -0 into 0
+		change := math.Round(s.Change) + 0
+		stat.Change = fmt.Sprintf("%+.0f%%", change)
+		switch {
+		case change > 0:
+			stat.Trend = "up"
+		case change < 0:
+			stat.Trend = "down"
+		}
+	}
+	return stat
+}
+
+// within reports whether the 2006-01-02 date falls in r
+func within(date string, r models.DateRange) bool {
+	t, err := time.Parse(time.DateOnly, date)
+	return err == nil && r.Contains(t)
+}
@@ -0,0 +1,157 @@
+package reports
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofit/config"
+	"github.com/gofit/mail/mailtest"
+	"github.com/gofit/models"
+)
+
+// newAccount returns the data directory of an account with 70 days of history up to today
+func newAccount(t *testing.T) string {
+	t.Helper()
+	dataDir := t.TempDir()
+	today := models.Today()
+	r := models.DateRange{From: today.AddDate(0, 0, -69), To: today}
+	history := models.History{Days: map[string]models.DayRecord{}, Fetched: map[string]models.DateRange{}}
+	for i, d := 0, r.From; !d.After(r.To); i, d = i+1, d.AddDate(0, 0, 1) {
+		history.Days[d.Format(time.DateOnly)] = models.DayRecord{
+			Steps:               6000 + 500*(i%9),
+			FairlyActiveMinutes: 10 + i%7,
+			VeryActiveMinutes:   5 + i%5,
+			RestingHeartRate:    58 + i%4,
+			ZoneMinutes:         map[string]int{"Fat Burn": 30 + i%10, "Cardio": 10 + i%6, "Peak": i % 3},
+		}
+	}
+	for _, m := range []string{"steps", "active_minutes", "heart_rate"} {
+		history.Fetched[m] = r
+	}
+	data, err := json.Marshal(models.CacheData{Timestamp: time.Now().Unix(), History: history})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "cache.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dataDir
+}
+
+// configure applies s for the test and restores the settings after it
+func configure(t *testing.T, s Settings) {
+	t.Helper()
+	previous := settings
+	Configure(s)
+	t.Cleanup(func() { Configure(previous) })
+}
+
+func TestPeriodRange(t *testing.T) {
+	today := time.Date(2025, 10, 15, 0, 0, 0, 0, time.UTC) // a Wednesday
+	for _, tc := range []struct {
+		period   Period
+		from, to string
+	}{
+		{Weekly, "2025-10-06", "2025-10-12"},
+		{Monthly, "2025-09-01", "2025-09-30"},
+	} {
+		r := tc.period.Range(today)
+		if got := r.From.Format(time.DateOnly) + " " + r.To.Format(time.DateOnly); got != tc.from+" "+tc.to {
+			t.Errorf("%s range %s, want %s %s", tc.period, got, tc.from, tc.to)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	dataDir := newAccount(t)
+	r := Weekly.Range(models.Today())
+
+	path, err := Write(dataDir, Weekly, r)
+	if err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if want := Path(dataDir, Weekly, r); path != want {
+		t.Errorf("path %s, want %s", path, want)
+	}
+	page, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("report not saved: %v", err)
+	}
+	for _, want := range []string{"Weekly report", "Steps", "Resting heart rate"} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("report lacks %q", want)
+		}
+	}
+	if n := strings.Count(string(page), "<svg"); n != 4 {
+		t.Errorf("report has %d charts, want 4", n)
+	}
+	if strings.Contains(string(page), "<script") {
+		t.Error("report loads scripts")
+	}
+}
+
+func TestWriteWithoutData(t *testing.T) {
+	if _, err := Write(t.TempDir(), Weekly, Weekly.Range(models.Today())); err == nil {
+		t.Error("Write without a cache succeeded")
+	}
+}
+
+func TestAfterSync(t *testing.T) {
+	dataDir := newAccount(t)
+	server := mailtest.NewServer(t)
+	configure(t, Settings{
+		Report: config.ReportConfig{Weekly: true, EmailTo: "me@example.com"},
+		SMTP:   server.Config("gofit@example.com"),
+	})
+	weekly := Path(dataDir, Weekly, Weekly.Range(models.Today()))
+	monthly := Path(dataDir, Monthly, Monthly.Range(models.Today()))
+
+	// A failed sync writes nothing
+	AfterSync(dataDir, os.ErrDeadlineExceeded)
+	if _, err := os.Stat(weekly); err == nil {
+		t.Fatal("report written after a failed sync")
+	}
+
+	AfterSync(dataDir, nil)
+	if _, err := os.Stat(weekly); err != nil {
+		t.Fatalf("weekly report not written: %v", err)
+	}
+	if _, err := os.Stat(monthly); err == nil {
+		t.Error("disabled monthly report written")
+	}
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d emails sent, want 1", len(messages))
+	}
+	if !strings.Contains(messages[0].Data, "Content-Type: image/png") {
+		t.Error("emailed report has no chart images")
+	}
+
+	// Later syncs of the same week leave the report alone
+	if err := os.WriteFile(weekly, []byte("kept"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	AfterSync(dataDir, nil)
+	if page, _ := os.ReadFile(weekly); string(page) != "kept" {
+		t.Error("report written twice in a week")
+	}
+	if n := len(server.Messages()); n != 1 {
+		t.Errorf("%d emails sent after a second sync, want 1", n)
+	}
+}
+
+func TestChartBounds(t *testing.T) {
+	bars := staticChart{labels: []string{"a", "b"}, series: []chartSeries{{values: []float64{3200, 8700}}}, goal: 10000}
+	if low, high := bars.bounds(); low != 0 || high != 10000 {
+		t.Errorf("bar bounds %v to %v, want 0 to 10000", low, high)
+	}
+	line := staticChart{line: true, labels: []string{"a", "b", "c"}, series: []chartSeries{{values: []float64{61, math.NaN(), 57}}}}
+	if low, high := line.bounds(); low != 50 || high != 70 {
+		t.Errorf("line bounds %v to %v, want 50 to 70", low, high)
+	}
+}
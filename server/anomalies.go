@@ -0,0 +1,35 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// recentAnomalyDays is how far back the dashboard lists anomalies
+const recentAnomalyDays = 30
+
+// anomalyList describes the recent anomalies of store for the dashboard
+func anomalyList(store *models.DataStore) templates.AnomalyList {
+	list := templates.AnomalyList{Days: recentAnomalyDays}
+	for _, a := range store.RecentAnomalies(recentAnomalyDays) {
+		list.Items = append(list.Items, templates.AnomalyItem{
+			Date:     a.Date.Format(time.DateOnly),
+			Label:    a.Metric.Label,
+			Value:    fmt.Sprintf("%d %s", a.Value, a.Metric.Unit),
+			Baseline: fmt.Sprintf("%.0f", a.Baseline),
+			ZScore:   fmt.Sprintf("%+.1fσ", a.ZScore),
+		})
+	}
+	return list
+}
+
+// anomaliesHandler renders the list of recent anomalies, swapped in when a sync finished
+func anomaliesHandler(w http.ResponseWriter, r *http.Request) {
+	component := templates.Anomalies(anomalyList(userStore(r)))
+	templ.Handler(component).ServeHTTP(w, r)
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// calendarHandler shows the heatmap of one metric over one calendar year, by default
+// steps over the current year
+func calendarHandler(w http.ResponseWriter, r *http.Request) {
+	store := userStore(r)
+	today := models.Today()
+
+	name := r.URL.Query().Get("metric")
+	if name == "" {
+		name = models.CalendarMetrics[0]
+	}
+	m, ok := models.LookupMetric(name)
+	if !ok || !slices.Contains(models.CalendarMetrics, name) {
+		http.Error(w, fmt.Sprintf("unknown metric %q", name), http.StatusBadRequest)
+		return
+	}
+
+	first := today.Year()
+	if earliest := store.Earliest(); !earliest.IsZero() {
+		first = earliest.Year()
+	}
+	year := today.Year()
+	if value := r.URL.Query().Get("year"); value != "" {
+		y, err := strconv.Atoi(value)
+		if err != nil || y < first || y > today.Year() {
+			http.Error(w, fmt.Sprintf("invalid year %q", value), http.StatusBadRequest)
+			return
+		}
+		year = y
+	}
+
+	view := templates.CalendarView{Metric: name, Year: year}
+	for _, metric := range models.CalendarMetrics {
+		m, _ := models.LookupMetric(metric)
+		view.Metrics = append(view.Metrics, templates.RangeOption{Name: m.Name, Label: m.Label})
+	}
+	for y := today.Year(); y >= first; y-- {
+		view.Years = append(view.Years, y)
+	}
+
+	data := store.Calendar(m, year)
+	if len(data.Days) > 0 {
+		data.DayURL = templates.UserURL(r.PathValue("user"), "/day/")
+		view.Chart = template.HTML(data.GenerateCalendarHeatmap())
+	}
+	templ.Handler(templates.Calendar(view)).ServeHTTP(w, r)
+}
+
+// dayHandler shows every value stored for the date in the path
+func dayHandler(w http.ResponseWriter, r *http.Request) {
+	date, err := time.Parse(time.DateOnly, r.PathValue("date"))
+	if err != nil {
+		http.Error(w, "Invalid date, expected YYYY-MM-DD", http.StatusBadRequest)
+		return
+	}
+	store := userStore(r)
+	record, metrics := store.Day(date)
+
+	day := templates.DayDetail{
+		Date:  date.Format(time.DateOnly),
+		Title: date.Format("Monday, January 2, 2006"),
+	}
+	if earliest := store.Earliest(); !earliest.IsZero() && date.After(earliest) {
+		day.Prev = date.AddDate(0, 0, -1).Format(time.DateOnly)
+	}
+	if date.Before(models.Today()) {
+		day.Next = date.AddDate(0, 0, 1).Format(time.DateOnly)
+	}
+
+	for _, m := range metrics {
+		value := m.Value(record)
+		if m.Rate && value == 0 {
+			continue
+		}
+		day.Values = append(day.Values, templates.DayValue{Label: m.Label, Value: fmt.Sprintf("%d %s", value, m.Unit)})
+	}
+	if len(record.ZoneMinutes) > 0 {
+		for _, zone := range models.HeartRateZones {
+			day.Zones = append(day.Zones, templates.DayValue{Label: zone, Value: fmt.Sprintf("%d min", record.ZoneMinutes[zone])})
+		}
+	}
+	templ.Handler(templates.Day(day)).ServeHTTP(w, r)
+}
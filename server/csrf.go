@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gofit/templates"
+)
+
+const (
+	csrfCookieName = "gofit_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFormField  = "csrf_token"
+)
+
+// isSafeMethod reports whether a request method cannot change state
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// csrfMiddleware issues a per-browser CSRF token and checks it on every state-changing request.
+// The token lives in an HttpOnly cookie and has to be echoed back in the X-CSRF-Token header
+// (sent by htmx from the Layout template) or in the csrf_token form field.
+func csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if cookie, err := r.Cookie(csrfCookieName); err == nil && cookie.Value != "" {
+			token = cookie.Value
+		}
+
+		if !isSafeMethod(r.Method) {
+			if token == "" || !validCSRFToken(r, token) || !sameOrigin(r) {
+				slog.WarnContext(r.Context(), "CSRF check failed", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr)
+				http.Error(w, "Invalid or missing CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		if token == "" {
+			var err error
+			token, err = newSessionID()
+			if err != nil {
+				http.Error(w, "Failed to create CSRF token", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    token,
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+
+		ctx := templates.WithCSRFToken(r.Context(), token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validCSRFToken(r *http.Request, token string) bool {
+	sent := r.Header.Get(csrfHeaderName)
+	if sent == "" {
+		sent = r.FormValue(csrfFormField)
+	}
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// sameOrigin rejects requests whose Origin header names another host
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/logging"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// startedAt is when the process started, shown on the status page
+var startedAt = time.Now()
+
+// healthzHandler answers as long as the process serves requests
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintln(w, "ok")
+}
+
+// readinessChecks returns the failed readiness checks: the data directory must be usable
+// and every account must hold a token Fitbit has not rejected
+func readinessChecks() []string {
+	var failed []string
+
+	users, err := models.ListUsers(dataRoot)
+	switch {
+	case err != nil:
+		failed = append(failed, fmt.Sprintf("data dir: %v", err))
+	case len(users) == 0:
+		failed = append(failed, "data dir: no accounts linked")
+	}
+	for _, user := range users {
+		dataDir := models.UserDataDir(dataRoot, user)
+		if _, err := models.LoadToken(dataDir); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: no token", user))
+		} else if models.TokenRevoked(dataDir) {
+			failed = append(failed, fmt.Sprintf("%s: token revoked", user))
+		}
+	}
+	return failed
+}
+
+// readyzHandler answers 503 when a readiness check failed. It is served without a login,
+// so it only counts the failures, /debug/status names them.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if failed := readinessChecks(); len(failed) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, "not ready: %d checks failed\n", len(failed))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// debugStatusHandler shows build, configuration, sync and error details, as JSON with ?format=json
+func debugStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status := templates.DebugStatus{
+		GoVersion: "unknown",
+		StartedAt: startedAt,
+		DataDir:   dataRoot,
+		Readiness: readinessChecks(),
+		Errors:    logging.RecentErrors(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		status.Version = info.Main.Version
+		status.GoVersion = info.GoVersion
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				status.Revision = s.Value
+			case "vcs.time":
+				status.RevisionTime = s.Value
+			case "vcs.modified":
+				if s.Value == "true" {
+					status.Revision += " (modified)"
+				}
+			}
+		}
+	}
+
+	var cfg bytes.Buffer
+	if err := appConfig.Redacted().Print(&cfg); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to print config", "err", err)
+	}
+	status.Config = cfg.String()
+
+	size, err := models.DirSize(dataRoot)
+	if err != nil && !os.IsNotExist(err) {
+		slog.WarnContext(r.Context(), "Failed to measure data dir", "err", err)
+	}
+	status.DataDirSize = size
+
+	users, err := models.ListUsers(dataRoot)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to list users", "err", err)
+	}
+	for _, user := range users {
+		status.Users = append(status.Users, userStatus(user))
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(status)
+		return
+	}
+	templ.Handler(templates.Debug(status)).ServeHTTP(w, r)
+}
+
+func userStatus(user string) templates.UserStatus {
+	dataDir := models.UserDataDir(dataRoot, user)
+	status := templates.UserStatus{
+		Name:    user,
+		Revoked: models.TokenRevoked(dataDir),
+	}
+
+	if token, err := models.LoadToken(dataDir); err == nil {
+		status.Authorized = true
+		status.TokenExpires = token.ExpiresAt
+	}
+
+	if cache, err := models.LoadCacheData(dataDir); err == nil {
+		for metric, at := range cache.MetricSyncTimes() {
+			status.Metrics = append(status.Metrics, templates.MetricSync{Metric: metric, SyncedAt: at})
+		}
+		sort.Slice(status.Metrics, func(i, j int) bool {
+			return status.Metrics[i].Metric < status.Metrics[j].Metric
+		})
+	}
+
+	if q, ok := models.QuotaFor(dataDir); ok {
+		status.Quota = &templates.QuotaStatus{Limit: q.Limit, Remaining: q.Remaining, ResetAt: q.ResetAt}
+	}
+	return status
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// userGoals returns the daily goals in effect for the user of r, none when they cannot be read
+func userGoals(r *http.Request) models.Goals {
+	goals, err := models.LoadGoals(userDataDir(r))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to load goals", "err", err)
+	}
+	return goals.Effective()
+}
+
+// goalRings describes today's progress towards the goals of the user of r
+func goalRings(r *http.Request, store *models.DataStore) []templates.GoalRing {
+	var rings []templates.GoalRing
+	for _, p := range store.GoalProgress(userGoals(r)) {
+		rings = append(rings, templates.GoalRing{
+			Metric:  p.Metric.Name,
+			Label:   p.Metric.Label,
+			Unit:    p.Metric.Unit,
+			Value:   p.Today,
+			Goal:    p.Goal,
+			Percent: p.Percent(),
+			Streak:  p.Streak.Current,
+			Longest: p.Streak.Longest,
+		})
+	}
+	return rings
+}
+
+// goalRingsHandler renders the goal rings, swapped in when a sync finished
+func goalRingsHandler(w http.ResponseWriter, r *http.Request) {
+	component := templates.GoalRings(goalRings(r, userStore(r)))
+	templ.Handler(component).ServeHTTP(w, r)
+}
+
+// goalFields describes the goals form from the stored goals
+func goalFields(goals models.GoalFile) []templates.GoalField {
+	var fields []templates.GoalField
+	for _, name := range models.GoalMetrics {
+		m, _ := models.LookupMetric(name)
+		field := templates.GoalField{Metric: name, Label: m.Label, Unit: m.Unit, Fitbit: goals.Fitbit[name]}
+		if goal, ok := goals.Overrides[name]; ok {
+			field.Override = strconv.Itoa(goal)
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// goalsHandler shows the goals page and saves the local goals posted from it.
+// Each goal_<metric> field holds a positive number, empty fields follow Fitbit.
+func goalsHandler(w http.ResponseWriter, r *http.Request) {
+	dataDir := userDataDir(r)
+	if r.Method == http.MethodGet {
+		goals, err := models.LoadGoals(dataDir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		templ.Handler(templates.Goals(goalFields(goals), "")).ServeHTTP(w, r)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+	overrides := models.Goals{}
+	for _, name := range models.GoalMetrics {
+		value := strings.TrimSpace(r.FormValue("goal_" + name))
+		if value == "" {
+			continue
+		}
+		goal, err := strconv.Atoi(value)
+		if err != nil || goal <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid %s goal %q", strings.ReplaceAll(name, "_", " "), value), http.StatusBadRequest)
+			return
+		}
+		overrides[name] = goal
+	}
+	if err := models.SaveGoalOverrides(dataDir, overrides); err != nil {
+		http.Error(w, "Failed to save goals: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Saved goals", "user", r.PathValue("user"), "overrides", len(overrides))
+
+	goals, err := models.LoadGoals(dataDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	templ.Handler(templates.GoalsForm(goalFields(goals), "Goals saved")).ServeHTTP(w, r)
+}
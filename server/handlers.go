@@ -1,13 +1,10 @@
 package server
 
 import (
-	"encoding/json"
-	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
-	"strconv"
 
 	"github.com/a-h/templ"
 	"github.com/gofit/models"
@@ -16,15 +13,16 @@ import (
 
 // HTTP handlers
 func profileHandler(w http.ResponseWriter, r *http.Request) {
-	profileData := models.Store.ProfileData
+	// The profile can be opened before the dashboard
+	profileData := userStore(r).Profile()
 
 	// Render the profile template with the profile data
-	component := templates.Profile(profileData)
+	component := templates.Profile(profileData, recordList(r))
 	templ.Handler(component).ServeHTTP(w, r)
 }
 
 func authHandler(w http.ResponseWriter, r *http.Request) {
-	component := templates.Auth()
+	component := templates.Auth(r.URL.Query().Get("user"))
 	templ.Handler(component).ServeHTTP(w, r)
 }
 
@@ -41,110 +39,80 @@ func authSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	user := r.FormValue("user")
+	if !models.ValidUserName(user) {
+		http.Error(w, "Invalid account name", http.StatusBadRequest)
+		return
+	}
+	dataDir := models.UserDataDir(dataRoot, user)
+
 	// Get the form values
 	account_info := models.Config{
 		ClientID:     r.FormValue("fitbit_id"),
 		ClientSecret: r.FormValue("fitbit_secret"),
 	}
 
-	// write the credentials to a file or database
-	filePath := filepath.Join("fitbit_data", "account_info.json")
-	account_data, err := json.MarshalIndent(account_info, "", "  ")
-	if err != nil {
-		log.Println("failed to indent account info data")
-	}
-
-	os.WriteFile(filePath, account_data, 0644)
-
-	err = models.PopulateDataStore(account_info.ClientID, account_info.ClientSecret, "fitbit_data", 14)
+	// write the credentials to a file
+	err = models.SaveClientInfo(dataDir, account_info)
 	if err != nil {
-		http.Error(w, "Failed to populate data store: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Failed to save account info: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	log.Println("Data store populated successfully")
-
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
-
-func findClientInfo(dataFolder string) (string, error) {
-
-	account_info_file := filepath.Join(dataFolder, "account_info.json")
-	if _, err := os.Stat(account_info_file); os.IsNotExist(err) {
-		// If account_info does not exist, redirect to the auth page
-		log.Println("Account info not found, redirecting to auth page")
-		return "", err
-
-	}
-	return account_info_file, nil
-}
-
-func loadClientInfo(account_info_file string) (models.Config, error) {
 
-	data, err := os.ReadFile(account_info_file)
-	if err != nil {
-		return models.Config{}, err
-	}
+	// The dashboard follows the first download
+	models.StartSync(account_info.ClientID, account_info.ClientSecret, dataDir)
+	slog.InfoContext(r.Context(), "Started first sync", "user", user)
 
-	var account_info models.Config
-	err = json.Unmarshal(data, &account_info)
-	if err != nil {
-		return models.Config{}, err
-	}
-	return account_info, nil
+	http.Redirect(w, r, templates.UserURL(user, "/"), http.StatusSeeOther)
 }
 
+// indexHandler renders the dashboard right away from the stored data and starts a
+// background sync when that data is older than the cache max age
 func indexHandler(w http.ResponseWriter, r *http.Request) {
-	if models.AuthFlowInProgress {
-		log.Println("Auth flow in progress, redirecting to auth page")
-		http.Redirect(w, r, "/auth", http.StatusFound)
-		return
-	}
-
-	account_info_file, err := findClientInfo("fitbit_data")
-	if err != nil {
-		log.Println("Account info not found, redirecting to auth page")
-		http.Redirect(w, r, "/auth", http.StatusFound)
+	user := r.PathValue("user")
+	dataDir := userDataDir(r)
+	account_info, err := models.LoadClientInfo(dataDir)
+	if os.IsNotExist(err) {
+		slog.InfoContext(r.Context(), "Account info not found, redirecting to auth page")
+		http.Redirect(w, r, "/auth?user="+user, http.StatusFound)
 		return
 	}
-
-	// Load client info
-	account_info, err := loadClientInfo(account_info_file)
 	if err != nil {
 		component := templates.Error("Failed to load account info: " + err.Error())
 		templ.Handler(component).ServeHTTP(w, r)
 		return
 	}
 
-	log.Println("Account info loaded successfully")
+	slog.DebugContext(r.Context(), "Account info loaded")
 
-	err = models.PopulateDataStore(account_info.ClientID, account_info.ClientSecret, "fitbit_data", 14)
+	stale, err := models.LoadDataStore(dataDir)
 	if err != nil {
-		component := templates.Error("Failed to populate data store: " + err.Error())
-		templ.Handler(component).ServeHTTP(w, r)
-		return
+		slog.InfoContext(r.Context(), "No stored data yet", "err", err)
+	}
+	if stale && models.StartSync(account_info.ClientID, account_info.ClientSecret, dataDir) {
+		slog.InfoContext(r.Context(), "Started background sync", "user", user)
 	}
-	stepsChart := models.Store.StepsData.GenerateLineChart()
-
-	eleChart := models.Store.ElevationData.GenerateLineChart()
-
-	calChart := models.Store.CaloriesData.GenerateLineChart()
-
-	heartChart := models.Store.HeartRateData.GenerateHeartRateChart()
-
-	restingHeartChart := models.Store.HeartRateData.GenerateRestingHeartRateChart()
 
-	component := templates.Index(
-		template.HTML(stepsChart),
-		template.HTML(eleChart),
-		template.HTML(calChart),
-		template.HTML(heartChart),
-		template.HTML(restingHeartChart))
+	store := models.StoreFor(dataDir)
+	q, err := requestedView(r, store)
+	if err != nil {
+		slog.WarnContext(r.Context(), "Invalid dashboard view, showing the default", "err", err)
+		q = defaultView()
+	}
+	view := buildView(r, store, q)
+	form := rangeForm(view, q, store.Earliest())
+	component := templates.Index(form, view.SyncedAt, models.SyncRunning(dataDir), models.SyncMetrics,
+		goalRings(r, store), newRecords(recordList(r)), anomalyList(store), comparisonSummary(view.Comparison), chartCards(view))
 	templ.Handler(component).ServeHTTP(w, r)
-
 }
 
 func removeSecretsHandler(w http.ResponseWriter, r *http.Request) {
-	account_info_file := filepath.Join("fitbit_data", "account_info.json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	account_info_file := filepath.Join(userDataDir(r), "account_info.json")
 	if _, err := os.Stat(account_info_file); os.IsNotExist(err) {
 		http.Error(w, "Account info not found", http.StatusNotFound)
 		return
@@ -155,64 +123,47 @@ func removeSecretsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to remove account info: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	log.Println("Account info removed successfully")
-	http.Redirect(w, r, "/auth", http.StatusFound)
+	slog.InfoContext(r.Context(), "Account info removed")
+	http.Redirect(w, r, "/auth?user="+r.PathValue("user"), http.StatusFound)
 }
 
-func updateDaysHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Update endpoint triggered")
-
+func disconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		component := templates.Disconnect()
+		templ.Handler(component).ServeHTTP(w, r)
+		return
+	}
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
-	// parse form data
+
 	err := r.ParseForm()
 	if err != nil {
 		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
 		return
 	}
+	purgeData := r.FormValue("purge_data") == "on"
 
-	days_back := r.FormValue("days_back")
-
-	log.Println("Updating days back to:", days_back)
-
-	days, err := strconv.Atoi(days_back)
-	if err != nil {
-		http.Error(w, "Invalid days back value", http.StatusBadRequest)
-		return
-	}
-	account_info_file, err := findClientInfo("fitbit_data")
+	// Missing client info is not fatal, the local tokens can still be removed
+	dataDir := userDataDir(r)
+	account_info, err := models.LoadClientInfo(dataDir)
 	if err != nil {
-		http.Error(w, "Account info not found: "+err.Error(), http.StatusInternalServerError)
-		return
+		slog.WarnContext(r.Context(), "Failed to load account info", "err", err)
 	}
-	// Load client info
-	account_info, err := loadClientInfo(account_info_file)
-	if err != nil {
-		http.Error(w, "Failed to load account info: "+err.Error(), http.StatusInternalServerError)
+
+	result, err := models.DisconnectAccount(account_info.ClientID, account_info.ClientSecret, dataDir, purgeData)
+	if err != nil && result.Revocation != models.RevokeFailed {
+		component := templates.Error("Failed to disconnect account: " + err.Error())
+		templ.Handler(component).ServeHTTP(w, r)
 		return
 	}
-
-	err = models.PopulateDataStore(account_info.ClientID, account_info.ClientSecret, "fitbit_data", days)
 	if err != nil {
-		http.Error(w, "Failed to populate data store: "+err.Error(), http.StatusInternalServerError)
-		return
+		slog.WarnContext(r.Context(), "Failed to revoke token", "err", err)
+	} else {
+		slog.InfoContext(r.Context(), "Account disconnected", "revocation", result.Revocation, "removed", result.Removed)
 	}
 
-	// Render charts
-	stepsChart := models.Store.StepsData.GenerateLineChart()
-	elevationChart := models.Store.ElevationData.GenerateLineChart()
-	caloriesChart := models.Store.CaloriesData.GenerateLineChart()
-	heartRateChart := models.Store.HeartRateData.GenerateHeartRateChart()
-	restingHeartChart := models.Store.HeartRateData.GenerateRestingHeartRateChart()
-
-	component := templates.Charts(
-		template.HTML(stepsChart),
-		template.HTML(elevationChart),
-		template.HTML(caloriesChart),
-		template.HTML(heartRateChart),
-		template.HTML(restingHeartChart),
-	)
+	component := templates.Disconnected(*result)
 	templ.Handler(component).ServeHTTP(w, r)
 }
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// correlationsHandler relates two daily metrics picked in the query: x, shifted lag days
+// back, against y over the preset in range. It defaults to steps against sleep over 12 months.
+func correlationsHandler(w http.ResponseWriter, r *http.Request) {
+	store := userStore(r)
+	query := r.URL.Query()
+	form := templates.CorrelationForm{X: "steps", Y: "sleep", Range: "12m", MaxLag: models.MaxCorrelationLag}
+	if v := query.Get("x"); v != "" {
+		form.X = v
+	}
+	if v := query.Get("y"); v != "" {
+		form.Y = v
+	}
+	if v := query.Get("range"); v != "" {
+		form.Range = v
+	}
+	if v := query.Get("lag"); v != "" {
+		lag, err := strconv.Atoi(v)
+		if err != nil || lag < 0 || lag > models.MaxCorrelationLag {
+			http.Error(w, fmt.Sprintf("lag must be between 0 and %d days", models.MaxCorrelationLag), http.StatusBadRequest)
+			return
+		}
+		form.Lag = lag
+	}
+
+	x, okX := models.LookupMetric(form.X)
+	y, okY := models.LookupMetric(form.Y)
+	if !okX || !okY {
+		http.Error(w, fmt.Sprintf("unknown metric %q or %q", form.X, form.Y), http.StatusBadRequest)
+		return
+	}
+	rng, ok := models.PresetRange(form.Range, store.Earliest())
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown range %q", form.Range), http.StatusBadRequest)
+		return
+	}
+
+	for _, m := range models.DailyMetrics {
+		form.Metrics = append(form.Metrics, templates.RangeOption{Name: m.Name, Label: m.Label})
+	}
+	for _, p := range models.Presets {
+		form.Presets = append(form.Presets, templates.RangeOption{Name: p.Name, Label: p.Label})
+	}
+
+	c := store.Correlate(x, y, form.Lag, rng)
+	result := templates.CorrelationResult{Points: len(c.Points)}
+	if len(c.Points) >= 3 {
+		result.Pearson = fmt.Sprintf("%+.2f", c.Pearson)
+		result.Spearman = fmt.Sprintf("%+.2f", c.Spearman)
+		result.Strength = correlationStrength(c.Pearson)
+		result.Regression = fmt.Sprintf("%s = %.1f %+.4f × %s", y.Label, c.Intercept, c.Slope, x.Label)
+		chart := c.ScatterChart()
+		result.Chart = template.HTML(chart.GenerateScatterChart())
+	}
+	templ.Handler(templates.Correlations(form, result)).ServeHTTP(w, r)
+}
+
+// correlationStrength describes a correlation coefficient in words
+func correlationStrength(r float64) string {
+	direction := "positive"
+	if r < 0 {
+		direction = "negative"
+	}
+	switch a := math.Abs(r); {
+	case a < 0.1:
+		return "negligible"
+	case a < 0.3:
+		return "weak " + direction
+	case a < 0.5:
+		return "moderate " + direction
+	}
+	return "strong " + direction
+}
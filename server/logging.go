@@ -1,37 +1,35 @@
 package server
 
 import (
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
-	"path/filepath"
-)
-
-func setupLogging() (*os.File, error) {
-	// Create logs directory if it doesn't exist
-	err := os.MkdirAll("logs", 0755)
-	if err != nil {
-		return nil, err
-	}
 
-	// Create log file with timestamp
-	logFileName := filepath.Join("logs", "app.log")
-	logFile, err := os.OpenFile(logFileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
-		return nil, err
-	}
+	"github.com/gofit/logging"
+)
 
-	// Check if running with air
+// setupLogging logs to the console and the configured rotating log file
+func setupLogging() (io.Closer, error) {
+	var console io.Writer = os.Stdout
+	// air already shows the output of the process, only log to the file
 	if os.Getenv("AIR_RESTART_COUNT") != "" {
-		log.SetOutput(logFile)
-	} else {
-		// Set log output to both file and console
-		mw := io.MultiWriter(os.Stdout, logFile)
-		log.SetOutput(mw)
+		console = nil
 	}
+	return logging.Setup(appConfig.Log, console)
+}
 
-	// Set log format to include timestamp
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-
-	return logFile, nil
+// logLevelHandler shows the current log level, or changes it when posted to
+func logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(r.FormValue("level"))); err != nil {
+			http.Error(w, "level must be debug, info, warn or error", http.StatusBadRequest)
+			return
+		}
+		logging.Level.Set(level)
+		slog.InfoContext(r.Context(), "Log level changed", "level", level)
+	}
+	fmt.Fprintln(w, logging.Level.Level())
 }
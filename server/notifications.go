@@ -0,0 +1,138 @@
+package server
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/notify"
+	"github.com/gofit/templates"
+)
+
+// ruleKindLabels name the rule kinds in the form of the notifications page
+var ruleKindLabels = map[models.RuleKind]string{
+	models.RuleBelow:        "Metric below a threshold by a time of day",
+	models.RuleBaseline:     "Metric of yesterday off its baseline",
+	models.RuleSyncFailing:  "Sync failing",
+	models.RuleTokenRevoked: "Fitbit authorization revoked",
+}
+
+// notificationsData describes the notifications page of the user of r
+func notificationsData(r *http.Request) (templates.NotificationsData, error) {
+	f, err := models.LoadNotifications(userDataDir(r))
+	if err != nil {
+		return templates.NotificationsData{}, err
+	}
+	data := templates.NotificationsData{Unread: f.Unread(), Channels: notify.Channels()}
+	for _, n := range f.Inbox {
+		data.Inbox = append(data.Inbox, templates.InboxItem{
+			Title:   n.Title,
+			Message: n.Message,
+			At:      n.At.Format("2006-01-02 15:04"),
+			Read:    n.Read,
+		})
+	}
+	for _, rule := range f.ActiveRules() {
+		data.Rules = append(data.Rules, templates.NotificationRule{ID: rule.ID, Description: rule.String()})
+	}
+	for _, kind := range models.RuleKinds {
+		data.Kinds = append(data.Kinds, templates.Option{Value: string(kind), Label: ruleKindLabels[kind]})
+	}
+	for _, m := range models.DailyMetrics {
+		data.Metrics = append(data.Metrics, templates.Option{Value: m.Name, Label: m.Label})
+	}
+	return data, nil
+}
+
+// renderNotifications renders the notifications panel after a change, with message
+// or the error that kept the change from being made
+func renderNotifications(w http.ResponseWriter, r *http.Request, message, errMessage string) {
+	data, err := notificationsData(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data.Message, data.Error = message, errMessage
+	templ.Handler(templates.NotificationsPanel(data)).ServeHTTP(w, r)
+}
+
+// notificationsHandler shows the inbox and the notification rules
+func notificationsHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := notificationsData(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	templ.Handler(templates.Notifications(data)).ServeHTTP(w, r)
+}
+
+// addRuleHandler adds the rule posted from the notifications page. The fields a
+// kind does not use are ignored.
+func addRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Failed to parse form data", http.StatusBadRequest)
+		return
+	}
+	rule := models.Rule{Kind: models.RuleKind(r.FormValue("kind"))}
+	number := func(name string) (int, bool) {
+		value := strings.TrimSpace(r.FormValue(name))
+		if value == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(value)
+		return n, err == nil
+	}
+	var ok bool
+	switch rule.Kind {
+	case models.RuleBelow:
+		rule.Metric, rule.At = r.FormValue("metric"), r.FormValue("at")
+		rule.Threshold, ok = number("threshold")
+	case models.RuleBaseline:
+		rule.Metric = r.FormValue("metric")
+		if rule.Threshold, ok = number("threshold"); ok {
+			rule.Days, ok = number("days")
+		}
+	case models.RuleSyncFailing:
+		rule.Hours, ok = number("hours")
+	default:
+		ok = true
+	}
+	if !ok {
+		renderNotifications(w, r, "", "Numbers must be whole numbers")
+		return
+	}
+
+	if err := models.AddRule(userDataDir(r), rule); err != nil {
+		renderNotifications(w, r, "", "Invalid rule: "+err.Error())
+		return
+	}
+	slog.InfoContext(r.Context(), "Added notification rule", "user", r.PathValue("user"), "rule", rule.String())
+	renderNotifications(w, r, "Rule added", "")
+}
+
+// deleteRuleHandler removes a rule from the notifications page
+func deleteRuleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid rule", http.StatusBadRequest)
+		return
+	}
+	if err := models.DeleteRule(userDataDir(r), id); err != nil {
+		http.Error(w, "Failed to delete rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.InfoContext(r.Context(), "Deleted notification rule", "user", r.PathValue("user"), "id", id)
+	renderNotifications(w, r, "Rule deleted", "")
+}
+
+// readNotificationsHandler marks the inbox as read
+func readNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if err := models.MarkInboxRead(userDataDir(r)); err != nil {
+		http.Error(w, "Failed to update inbox: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	renderNotifications(w, r, "", "")
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// viewQuery is the date range and rollup asked for in the query of a dashboard request
+type viewQuery struct {
+	rng     models.DateRange
+	preset  string // "" for dates picked by hand
+	rollup  models.Rollup
+	compare models.CompareMode // "" when not comparing
+}
+
+// defaultView shows the configured default days, grouped automatically
+func defaultView() viewQuery {
+	return viewQuery{
+		rng:    models.LastDays(appConfig.Dashboard.DefaultDays),
+		rollup: models.Rollup{Aggregation: models.Mean},
+	}
+}
+
+// requestedView reads the view of the dashboard from the query of r: a preset name in
+// range or from/to dates, and the granularity and agg of the rollup. Without a range
+// the configured default days are shown.
+func requestedView(r *http.Request, store *models.DataStore) (viewQuery, error) {
+	query := r.URL.Query()
+	q := defaultView()
+
+	rollup, ok := models.ParseRollup(query.Get("granularity"), query.Get("agg"))
+	if !ok {
+		return q, fmt.Errorf("unknown granularity %q or aggregation %q", query.Get("granularity"), query.Get("agg"))
+	}
+	q.rollup = rollup
+
+	compare, ok := models.ParseCompareMode(query.Get("compare"))
+	if !ok {
+		return q, fmt.Errorf("unknown comparison %q", query.Get("compare"))
+	}
+	q.compare = compare
+
+	if name := query.Get("range"); name != "" {
+		rng, ok := models.PresetRange(name, store.Earliest())
+		if !ok {
+			return q, fmt.Errorf("unknown range %q", name)
+		}
+		q.rng, q.preset = rng, name
+		return q, nil
+	}
+	if query.Get("from") == "" && query.Get("to") == "" {
+		return q, nil
+	}
+	rng, err := models.ParseDateRange(query.Get("from"), query.Get("to"), store.Earliest())
+	if err != nil {
+		return q, err
+	}
+	q.rng = rng
+	return q, nil
+}
+
+// buildView draws the data of store for q with the goals of the user of r
+func buildView(r *http.Request, store *models.DataStore, q viewQuery) models.StoreView {
+	view := store.View(q.rng, q.rollup)
+	if q.compare != "" {
+		view.Comparison = store.Compare(q.rng, q.rollup, q.compare)
+	}
+	goals := userGoals(r)
+	view.SetGoals(goals)
+	view.Summaries = store.Summaries(q.rng, goals)
+	return view
+}
+
+// compareLabels name the comparisons on the toggle
+var compareLabels = map[models.CompareMode]string{
+	models.ComparePrevious: "Previous period",
+	models.CompareYear:     "A year earlier",
+}
+
+// comparisonSummary describes the metric changes of a comparison, nil when not comparing
+func comparisonSummary(c *models.Comparison) *templates.ComparisonSummary {
+	if c == nil {
+		return nil
+	}
+	summary := &templates.ComparisonSummary{
+		Title: c.Current.String() + " vs " + c.Previous.String(),
+	}
+	for _, d := range c.Deltas {
+		delta := templates.ComparisonDelta{
+			Label:    d.Metric.Label,
+			Current:  fmt.Sprintf("%.0f %s", d.Current, d.Metric.Unit),
+			Previous: fmt.Sprintf("%.0f %s", d.Previous, d.Metric.Unit),
+			Change:   "n/a",
+			Trend:    "flat",
+		}
+		if d.Comparable {
+			delta.Change = fmt.Sprintf("%+.1f%%", d.Percent)
+			switch {
+			case d.Percent >= 0.5:
+				delta.Trend = "up"
+			case d.Percent <= -0.5:
+				delta.Trend = "down"
+			}
+		}
+		summary.Deltas = append(summary.Deltas, delta)
+	}
+	return summary
+}
+
+// rangeForm describes the view shown for the range picker
+func rangeForm(view models.StoreView, q viewQuery, earliest time.Time) templates.RangeForm {
+	form := templates.RangeForm{
+		Preset:      q.preset,
+		From:        view.Range.From.Format(time.DateOnly),
+		To:          view.Range.To.Format(time.DateOnly),
+		Today:       models.Today().Format(time.DateOnly),
+		Granularity: "auto",
+		Aggregation: string(view.Rollup.Aggregation),
+		Compare:     "off",
+	}
+	if q.compare != "" {
+		form.Compare = string(q.compare)
+	}
+	if q.rollup.Granularity != "" {
+		form.Granularity = string(q.rollup.Granularity)
+	}
+	if !earliest.IsZero() {
+		form.Earliest = earliest.Format(time.DateOnly)
+	}
+	for _, p := range models.Presets {
+		form.Presets = append(form.Presets, templates.RangeOption{Name: p.Name, Label: p.Label})
+	}
+	form.Granularities = append(form.Granularities, templates.RangeOption{Name: "auto", Label: "Auto"})
+	for _, g := range models.Granularities {
+		form.Granularities = append(form.Granularities, templates.RangeOption{Name: string(g), Label: optionLabel(string(g))})
+	}
+	for _, a := range models.Aggregations {
+		form.Aggregations = append(form.Aggregations, templates.RangeOption{Name: string(a), Label: optionLabel(string(a))})
+	}
+
+	form.CompareModes = append(form.CompareModes, templates.RangeOption{Name: "off", Label: "Nothing"})
+	for _, m := range models.CompareModes {
+		form.CompareModes = append(form.CompareModes, templates.RangeOption{Name: string(m), Label: compareLabels[m]})
+	}
+
+	form.Summary = fmt.Sprintf("%d days", view.Range.Days())
+	if g := view.Rollup.Granularity; g != models.Daily {
+		form.Summary += fmt.Sprintf(", %s by %s", view.Rollup.Aggregation, g)
+	}
+	return form
+}
+
+// optionLabel capitalizes a granularity or aggregation name for the toggles
+func optionLabel(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// chartsHandler redraws the charts for another date range and points the address bar
+// at the dashboard showing that range, so it can be bookmarked and shared
+func chartsHandler(w http.ResponseWriter, r *http.Request) {
+	store := userStore(r)
+	q, err := requestedView(r, store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	view := buildView(r, store, q)
+	form := rangeForm(view, q, store.Earliest())
+	w.Header().Set("HX-Push-Url", templates.UserURL(r.PathValue("user"), "/?"+form.Query()))
+	component := templates.ChartsUpdate(form, comparisonSummary(view.Comparison), chartCards(view))
+	templ.Handler(component).ServeHTTP(w, r)
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// newRecordDays is how long the dashboard highlights a beaten record
+const newRecordDays = 7
+
+// recordList describes the records of the user of r, nil lists when they cannot be read
+func recordList(r *http.Request) templates.RecordList {
+	var list templates.RecordList
+	records, err := models.CurrentRecords(userDataDir(r))
+	if err != nil {
+		slog.WarnContext(r.Context(), "Failed to load records", "err", err)
+		return list
+	}
+
+	since := time.Now().AddDate(0, 0, -newRecordDays)
+	for _, kind := range models.RecordKinds {
+		record, ok := records.Records[kind.Name]
+		if !ok {
+			continue
+		}
+		item := templates.PersonalRecord{
+			Label: kind.Label,
+			Value: fmt.Sprintf("%d %s", record.Value, kind.Unit),
+			Date:  record.Date,
+			New:   record.SetAt.After(since),
+		}
+		if item.New {
+			item.Previous = fmt.Sprintf("%d %s", record.Previous, kind.Unit)
+		}
+		list.Records = append(list.Records, item)
+	}
+
+	for _, m := range records.Milestones {
+		list.Milestones = append(list.Milestones, templates.DistanceMilestone{
+			Label: fmt.Sprintf("%d km", m.Km),
+			Date:  m.Date,
+			New:   m.SetAt.After(since),
+		})
+	}
+	list.Lifetime = fmt.Sprintf("%.1f km", float64(records.Distance)/1000)
+	for _, km := range models.DistanceMilestones {
+		if records.Distance < km*1000 {
+			list.Next = fmt.Sprintf("%d km, %.1f km to go", km, float64(km*1000-records.Distance)/1000)
+			break
+		}
+	}
+	return list
+}
+
+// newRecords picks the records and milestones of list set in the last newRecordDays
+func newRecords(list templates.RecordList) []templates.PersonalRecord {
+	var records []templates.PersonalRecord
+	for _, record := range list.Records {
+		if record.New {
+			records = append(records, record)
+		}
+	}
+	for _, m := range list.Milestones {
+		if m.New {
+			records = append(records, templates.PersonalRecord{Label: "Lifetime distance", Value: m.Label, Date: m.Date, New: true})
+		}
+	}
+	return records
+}
+
+// newRecordsHandler renders the highlight of new records, swapped in when a sync finished
+func newRecordsHandler(w http.ResponseWriter, r *http.Request) {
+	component := templates.NewRecords(newRecords(recordList(r)))
+	templ.Handler(component).ServeHTTP(w, r)
+}
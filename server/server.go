@@ -1,36 +1,150 @@
 package server
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
+	"os/signal"
+	"syscall"
+
+	"github.com/gofit/config"
+	"github.com/gofit/logging"
+	"github.com/gofit/models"
+	"github.com/gofit/static"
 )
 
-func Serve() {
+// appConfig is the configuration the server was started with
+var appConfig = config.Default()
+
+// newRouter registers all routes on a dedicated mux
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Serve the embedded stylesheets and scripts
+	mux.Handle("GET "+static.Prefix, static.Handler())
+
+	// Set up HTTP routes. Mutating routes only accept POST, the mux answers 405 otherwise.
+	mux.Handle("GET /{$}", http.HandlerFunc(rootHandler))
+	mux.Handle("GET /login", http.HandlerFunc(loginHandler))
+	mux.Handle("POST /login", http.HandlerFunc(loginHandler))
+	mux.Handle("POST /logout", http.HandlerFunc(logoutHandler))
+	mux.Handle("GET /auth", http.HandlerFunc(authHandler))
+	mux.Handle("POST /auth-submit", http.HandlerFunc(authSubmitHandler))
+	mux.Handle("GET /healthz", http.HandlerFunc(healthzHandler))
+	mux.Handle("GET /readyz", http.HandlerFunc(readyzHandler))
+	mux.Handle("GET /debug/status", http.HandlerFunc(debugStatusHandler))
+	mux.Handle("GET /debug/log-level", http.HandlerFunc(logLevelHandler))
+	mux.Handle("POST /debug/log-level", http.HandlerFunc(logLevelHandler))
+
+	// Per-user routes
+	mux.Handle("GET /u/{user}/{$}", withUser(http.HandlerFunc(indexHandler)))
+	mux.Handle("GET /u/{user}/profile", withUser(http.HandlerFunc(profileHandler)))
+	mux.Handle("GET /u/{user}/records/new", withUser(http.HandlerFunc(newRecordsHandler)))
+	mux.Handle("POST /u/{user}/remove-secrets", withUser(http.HandlerFunc(removeSecretsHandler)))
+	mux.Handle("GET /u/{user}/disconnect", withUser(http.HandlerFunc(disconnectHandler)))
+	mux.Handle("POST /u/{user}/disconnect", withUser(http.HandlerFunc(disconnectHandler)))
+	mux.Handle("GET /u/{user}/charts", withUser(http.HandlerFunc(chartsHandler)))
+	mux.Handle("GET /u/{user}/cards/{card}", withUser(http.HandlerFunc(cardHandler)))
+	mux.Handle("GET /u/{user}/anomalies", withUser(http.HandlerFunc(anomaliesHandler)))
+	mux.Handle("GET /u/{user}/api/stats", withUser(http.HandlerFunc(statsHandler)))
+	mux.Handle("GET /u/{user}/calendar", withUser(http.HandlerFunc(calendarHandler)))
+	mux.Handle("GET /u/{user}/day/{date}", withUser(http.HandlerFunc(dayHandler)))
+	mux.Handle("GET /u/{user}/insights/correlations", withUser(http.HandlerFunc(correlationsHandler)))
+	mux.Handle("GET /u/{user}/goals", withUser(http.HandlerFunc(goalsHandler)))
+	mux.Handle("POST /u/{user}/goals", withUser(http.HandlerFunc(goalsHandler)))
+	mux.Handle("GET /u/{user}/goals/rings", withUser(http.HandlerFunc(goalRingsHandler)))
+	mux.Handle("GET /u/{user}/notifications", withUser(http.HandlerFunc(notificationsHandler)))
+	mux.Handle("POST /u/{user}/notifications/rules", withUser(http.HandlerFunc(addRuleHandler)))
+	mux.Handle("POST /u/{user}/notifications/rules/{id}/delete", withUser(http.HandlerFunc(deleteRuleHandler)))
+	mux.Handle("POST /u/{user}/notifications/read", withUser(http.HandlerFunc(readNotificationsHandler)))
+	mux.Handle("POST /u/{user}/sync", withUser(http.HandlerFunc(syncHandler)))
+	mux.Handle("GET /u/{user}/sync/badge", withUser(http.HandlerFunc(syncBadgeHandler)))
+	mux.Handle("GET /u/{user}/sync/events", withUser(http.HandlerFunc(syncEventsHandler)))
+
+	return mux
+}
+
+// Serve runs the dashboard until SIGINT or SIGTERM. It returns an error when the
+// listener cannot be opened or the shutdown does not complete cleanly.
+func Serve(cfg *config.Config) error {
+	appConfig = cfg
+	dataRoot = cfg.DataDir
 
 	logFile, err := setupLogging()
 	if err != nil {
-		log.Fatalf("Failed to set up logging: %v", err)
+		return fmt.Errorf("failed to set up logging: %w", err)
 	}
 	defer logFile.Close()
 
-	// Serve static files
-	fs := http.FileServer(http.Dir("static"))
-	http.Handle("/static/", http.StripPrefix("/static/", fs))
+	if missing := static.Missing(); len(missing) > 0 {
+		slog.Warn("Vendored scripts are missing, pages load them from their CDNs until they are fetched with ./launch.sh --vendor, committed and rebuilt", "missing", missing)
+	}
+
+	// Every request is logged, CSRF tokens are checked for every route and
+	// sessions for every route except login and static files
+	handler := loggingMiddleware(requireLogin(csrfMiddleware(newRouter())))
 
-	// Set up HTTP routes
-	http.Handle("/", loggingMiddleware(http.HandlerFunc(indexHandler)))
-	http.Handle("/auth", loggingMiddleware(http.HandlerFunc(authHandler)))
-	http.Handle("/auth-submit", loggingMiddleware(http.HandlerFunc(authSubmitHandler)))
-	http.Handle("/profile", loggingMiddleware(http.HandlerFunc(profileHandler)))
-	http.Handle("/remove-secrets", loggingMiddleware(http.HandlerFunc(removeSecretsHandler)))
-	http.Handle("/update-days", loggingMiddleware(http.HandlerFunc(updateDaysHandler)))
+	srv := &http.Server{
+		Addr:              cfg.Addr(),
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Server.ReadTimeout.Duration,
+		ReadTimeout:       cfg.Server.ReadTimeout.Duration,
+		WriteTimeout:      cfg.Server.WriteTimeout.Duration,
+		IdleTimeout:       cfg.Server.IdleTimeout.Duration,
+	}
+
+	// Shutdown does not wait for event streams to end on their own, cancel their requests instead
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	srv.BaseContext = func(net.Listener) context.Context { return baseCtx }
+	srv.RegisterOnShutdown(cancelRequests)
 
-	port := "8081"
-	host := "0.0.0.0"
+	// Bind before logging success so a taken port fails the process right away
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", srv.Addr, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+
+	slog.Info("Server starting", "url", "http://"+cfg.Addr(), "log_level", logging.Level.Level())
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("server failed: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+	slog.Info("Shutting down, waiting for in-flight requests and syncs")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
+
+	var errs []error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("failed to stop server: %w", err))
+	}
+	if err := models.WaitForSyncs(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("syncs still running: %w", err))
+	}
+	if err := models.FlushStores(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to flush data stores: %w", err))
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		errs = append(errs, err)
+	}
 
-	log.Printf("Server starting on http://%s:%s", host, port)
-	log.Printf("Visit http://%s:%s to see the charts", host, port)
-	if err := http.ListenAndServe(host+":"+port, nil); err != nil {
-		log.Printf("Could not listen on %s: %v\n", port, err)
+	if len(errs) == 0 {
+		slog.Info("Server stopped")
 	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/static"
+	"github.com/gofit/templates"
+)
+
+const (
+	sessionCookieName = "gofit_session"
+	sessionTTL        = 7 * 24 * time.Hour
+)
+
+type session struct {
+	username  string
+	expiresAt time.Time
+}
+
+// sessionStore keeps dashboard sessions in memory, a restart logs everybody out
+type sessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+var sessions = &sessionStore{sessions: map[string]session{}}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *sessionStore) create(username string) (string, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop expired sessions while we hold the lock anyway
+	now := time.Now()
+	for key, sess := range s.sessions {
+		if now.After(sess.expiresAt) {
+			delete(s.sessions, key)
+		}
+	}
+
+	s.sessions[id] = session{username: username, expiresAt: now.Add(sessionTTL)}
+	return id, nil
+}
+
+func (s *sessionStore) lookup(id string) (session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || time.Now().After(sess.expiresAt) {
+		delete(s.sessions, id)
+		return session{}, false
+	}
+	return sess, true
+}
+
+func (s *sessionStore) delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, id)
+}
+
+// currentSession returns the session of the request cookie, if any
+func currentSession(r *http.Request) (session, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return session{}, false
+	}
+	return sessions.lookup(cookie.Value)
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, id string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// isPublicPath lists the routes reachable without logging in, the login page, static
+// files and the health checks. The OAuth callback is served by its own listener in
+// models and never passes through this middleware.
+func isPublicPath(path string) bool {
+	return path == "/login" || path == "/healthz" || path == "/readyz" || strings.HasPrefix(path, static.Prefix)
+}
+
+// requireLogin sends requests without a valid session to the login page
+func requireLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sess, ok := currentSession(r)
+		if !ok {
+			loginURL := "/login?next=" + url.QueryEscape(r.URL.RequestURI())
+			if r.Header.Get("HX-Request") == "true" {
+				// htmx would swap the login page into the target, make it navigate instead
+				w.Header().Set("HX-Redirect", loginURL)
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, loginURL, http.StatusFound)
+			return
+		}
+
+		ctx := templates.WithLogin(r.Context(), sess.username)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// safeNext only allows redirects to local paths
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	hasLogins, err := models.HasLogins(dataRoot)
+	if err != nil {
+		http.Error(w, "Failed to load logins: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The first login is created with 'gofit login create', anyone on the network could claim it here
+	setup := !hasLogins
+	next := safeNext(r.FormValue("next"))
+
+	if r.Method == http.MethodGet {
+		component := templates.Login(setup, next, "")
+		templ.Handler(component).ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if setup {
+		component := templates.Login(setup, next, "")
+		templ.Handler(component, templ.WithStatus(http.StatusForbidden)).ServeHTTP(w, r)
+		return
+	}
+
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+
+	err = models.VerifyLogin(dataRoot, username, password)
+	if errors.Is(err, models.ErrInvalidLogin) {
+		slog.WarnContext(r.Context(), "Failed login attempt", "username", username, "remote", r.RemoteAddr)
+		component := templates.Login(setup, next, "Invalid username or password")
+		templ.Handler(component, templ.WithStatus(http.StatusUnauthorized)).ServeHTTP(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify login: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := sessions.create(username)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	setSessionCookie(w, r, id, int(sessionTTL.Seconds()))
+	slog.InfoContext(r.Context(), "User logged in", "username", username)
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		sessions.delete(cookie.Value)
+	}
+	setSessionCookie(w, r, "", -1)
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
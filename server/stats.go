@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// cardStats formats a summary for the top of a chart card
+func cardStats(s models.Summary) ([]templates.CardStat, templates.CardTrend) {
+	stats := []templates.CardStat{
+		{Label: "Mean", Value: fmt.Sprintf("%.0f %s", s.Mean, s.Unit)},
+		{Label: "Median", Value: fmt.Sprintf("%.0f", s.Median)},
+		{Label: "Std dev", Value: fmt.Sprintf("%.0f", s.StdDev)},
+		{Label: "Min", Value: fmt.Sprintf("%d on %s", s.Min, models.ShortDate(s.MinDate))},
+		{Label: "Max", Value: fmt.Sprintf("%d on %s", s.Max, models.ShortDate(s.MaxDate))},
+	}
+	if s.Goal > 0 {
+		stats = append(stats, templates.CardStat{Label: "Goal reached", Value: fmt.Sprintf("%.0f%% of days", s.GoalPercent)})
+	}
+	stats = append(stats, templates.CardStat{Label: "Trend", Value: fmt.Sprintf("%+.1f %s/day", s.Slope, s.Unit)})
+	return stats, trend(s)
+}
+
+// trend describes the change of the mean against the prior period in words
+func trend(s models.Summary) templates.CardTrend {
+	if !s.Comparable {
+		return templates.CardTrend{Text: "no data for the prior period", Direction: "flat"}
+	}
+	change := math.Round(s.Change)
+	switch {
+	case change > 0:
+		return templates.CardTrend{Text: fmt.Sprintf("up %.0f%% vs prior period", change), Direction: "up"}
+	case change < 0:
+		return templates.CardTrend{Text: fmt.Sprintf("down %.0f%% vs prior period", -change), Direction: "down"}
+	}
+	return templates.CardTrend{Text: "flat vs prior period", Direction: "flat"}
+}
+
+// statsResponse is the answer of the stats API
+type statsResponse struct {
+	Range   models.DateRange `json:"range"`
+	Metrics []models.Summary `json:"metrics"`
+}
+
+// statsHandler answers the summaries of the daily metrics as JSON, for the range picked
+// with the query parameters of the dashboard. metric limits the answer to one metric.
+func statsHandler(w http.ResponseWriter, r *http.Request) {
+	store := userStore(r)
+	q, err := requestedView(r, store)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.URL.Query().Get("metric")
+	if _, ok := models.LookupMetric(name); name != "" && !ok {
+		http.Error(w, fmt.Sprintf("unknown metric %q", name), http.StatusBadRequest)
+		return
+	}
+
+	summaries := store.Summaries(q.rng, userGoals(r))
+	response := statsResponse{Range: q.rng, Metrics: []models.Summary{}}
+	for _, m := range models.DailyMetrics {
+		if name == "" || m.Name == name {
+			response.Metrics = append(response.Metrics, summaries[m.Name])
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(response)
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/a-h/templ"
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// syncHeartbeat keeps idle event streams open through proxies
+const syncHeartbeat = 15 * time.Second
+
+// dashboardCard describes one chart card and how to draw it from a store view. metric
+// is the daily metric summarized above the chart, while comparing periods the card shows
+// its overlay chart instead.
+type dashboardCard struct {
+	id          string
+	title       string
+	description string
+	syncMetric  string
+	metric      string
+	render      func(models.StoreView) string
+}
+
+var dashboardCards = []dashboardCard{
+	{"steps", "Steps Chart", "View your daily step count", "steps", "steps", func(v models.StoreView) string {
+		return lineChart(v.Steps)
+	}},
+	{"elevation", "Elevation Chart", "View your elevation data", "elevation", "elevation", func(v models.StoreView) string {
+		return lineChart(v.Elevation)
+	}},
+	{"calories", "Calories Chart", "View your calorie data", "calories", "calories", func(v models.StoreView) string {
+		return lineChart(v.Calories)
+	}},
+	{"floors", "Floors Chart", "View your daily floors climbed", "floors", "floors", func(v models.StoreView) string {
+		return lineChart(v.Floors)
+	}},
+	{"active-minutes", "Active Minutes Chart", "View your fairly and very active minutes", "active_minutes", "active_minutes", func(v models.StoreView) string {
+		return lineChart(v.ActiveMinutes)
+	}},
+	{"heart-rate", "Heart Rate Chart", "", "heart_rate", "zone_minutes", func(v models.StoreView) string {
+		if len(v.HeartRate.XAxis) == 0 {
+			return ""
+		}
+		return v.HeartRate.GenerateHeartRateChart()
+	}},
+	{"training-load", "Training Load Chart", "Fitness, fatigue and form from heart rate zone minutes", "heart_rate", "training_load", func(v models.StoreView) string {
+		if len(v.TrainingLoad.XAxis) == 0 {
+			return ""
+		}
+		return v.TrainingLoad.GenerateTrainingLoadChart()
+	}},
+	{"resting-heart-rate", "Resting Heart Rate Chart", "View your resting heart rate data", "heart_rate", "resting_heart_rate", func(v models.StoreView) string {
+		if len(v.HeartRate.XAxis) == 0 {
+			return ""
+		}
+		return v.HeartRate.GenerateRestingHeartRateChart()
+	}},
+}
+
+func lineChart(data models.ChartData) string {
+	if len(data.XAxis) == 0 {
+		return ""
+	}
+	return data.GenerateLineChart()
+}
+
+func (c dashboardCard) build(view models.StoreView) templates.ChartCard {
+	var chart string
+	if view.Comparison != nil {
+		chart = lineChart(view.Comparison.Charts[c.metric])
+	} else {
+		chart = c.render(view)
+	}
+	card := templates.ChartCard{
+		ID:          c.id,
+		Title:       c.title,
+		Description: c.description,
+		SyncMetric:  c.syncMetric,
+		Chart:       template.HTML(chart),
+	}
+	if summary, ok := view.Summaries[c.metric]; ok && summary.Days > 0 {
+		card.Stats, card.Trend = cardStats(summary)
+	}
+	return card
+}
+
+// chartCards draws every card of the dashboard
+func chartCards(view models.StoreView) []templates.ChartCard {
+	cards := make([]templates.ChartCard, 0, len(dashboardCards))
+	for _, c := range dashboardCards {
+		cards = append(cards, c.build(view))
+	}
+	return cards
+}
+
+// cardHandler renders a single chart card, used to swap it in when its metric finished syncing
+func cardHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("card")
+	for _, c := range dashboardCards {
+		if c.id != id {
+			continue
+		}
+		store := userStore(r)
+		q, err := requestedView(r, store)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		view := buildView(r, store, q)
+		templ.Handler(templates.Card(c.build(view))).ServeHTTP(w, r)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// syncBadgeHandler renders the "last updated" badge
+func syncBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	dataDir := userDataDir(r)
+	syncedAt := models.StoreFor(dataDir).SyncedAt()
+	component := templates.SyncBadge(syncedAt, models.SyncRunning(dataDir), models.SyncMetrics)
+	templ.Handler(component).ServeHTTP(w, r)
+}
+
+// syncHandler starts a background sync and answers with the badge following its progress
+func syncHandler(w http.ResponseWriter, r *http.Request) {
+	dataDir := userDataDir(r)
+	account_info, err := models.LoadClientInfo(dataDir)
+	if err != nil {
+		http.Error(w, "Failed to load account info: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if models.StartSync(account_info.ClientID, account_info.ClientSecret, dataDir) {
+		slog.InfoContext(r.Context(), "Started background sync", "user", r.PathValue("user"))
+	}
+	syncBadgeHandler(w, r)
+}
+
+// syncEventsHandler streams the progress of the running sync as server-sent events.
+// "progress" events carry a models.SyncEvent per metric, a "complete" event ends the stream.
+func syncEventsHandler(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// A sync can take longer than the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		slog.DebugContext(r.Context(), "Failed to clear write deadline", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	past, events, stop, running := models.WatchSync(userDataDir(r))
+	defer stop()
+	if !running {
+		// Finished before the browser connected
+		last, ok := models.LastSyncResult(userDataDir(r))
+		if !ok {
+			last = models.SyncEvent{Status: models.SyncDone}
+		}
+		writeSyncEvent(w, "complete", last)
+		rc.Flush()
+		return
+	}
+	for _, e := range past {
+		writeSyncEvent(w, "progress", e)
+	}
+	rc.Flush()
+
+	heartbeat := time.NewTicker(syncHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, open := <-events:
+			if !open || e.Metric == "" {
+				if !open {
+					e = models.SyncEvent{Status: models.SyncDone}
+				}
+				writeSyncEvent(w, "complete", e)
+				rc.Flush()
+				return
+			}
+			writeSyncEvent(w, "progress", e)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSyncEvent(w http.ResponseWriter, name string, e models.SyncEvent) {
+	data, _ := json.Marshal(e)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/gofit/models"
+	"github.com/gofit/templates"
+)
+
+// dataRoot holds one data directory per linked Fitbit account, set from the config in Serve
+var dataRoot = "fitbit_data"
+
+// userDataDir returns the data directory of the user in the request path
+func userDataDir(r *http.Request) string {
+	return models.UserDataDir(dataRoot, r.PathValue("user"))
+}
+
+// userStore returns the data store of the user of r, filled from the cache when the
+// server has not loaded it yet
+func userStore(r *http.Request) *models.DataStore {
+	dataDir := userDataDir(r)
+	if _, err := models.LoadDataStore(dataDir); err != nil {
+		slog.DebugContext(r.Context(), "No stored data", "err", err)
+	}
+	return models.StoreFor(dataDir)
+}
+
+// withUser rejects unknown users and makes the user switcher state available to templates
+func withUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := r.PathValue("user")
+		if !models.UserExists(dataRoot, user) {
+			http.NotFound(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(navContext(r, user)))
+	})
+}
+
+func navContext(r *http.Request, user string) context.Context {
+	users, err := models.ListUsers(dataRoot)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to list users", "err", err)
+	}
+	return templates.WithUserNav(r.Context(), templates.UserNav{Current: user, Users: users})
+}
+
+// rootHandler sends visitors to the first linked account, or to the auth page when there is none
+func rootHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := models.ListUsers(dataRoot)
+	if err != nil || len(users) == 0 {
+		http.Redirect(w, r, "/auth", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, templates.UserURL(users[0], "/"), http.StatusFound)
+}
@@ -0,0 +1,76 @@
+// showToast briefly shows a message in the #toast element of the dashboard
+function showToast(message) {
+	const toast = htmx.find("#toast");
+	if (!toast) {
+		return;
+	}
+	toast.textContent = message;
+	toast.classList.add("show");
+	setTimeout(() => {
+		toast.classList.remove("show");
+	}, 3000);
+}
+
+// followSync listens to the event stream of a running sync and reloads each chart
+// card as soon as its metric is downloaded. The badge is replaced once it completes.
+function followSync(badge) {
+	const url = badge.dataset.events;
+	if (!url) {
+		return;
+	}
+
+	const metrics = (badge.dataset.metrics || "").split(" ").filter(Boolean);
+	const finished = new Set();
+	const progress = document.getElementById("sync-progress");
+	const source = new EventSource(url);
+
+	source.addEventListener("progress", (e) => {
+		const event = JSON.parse(e.data);
+		if (event.metric === "authorization") {
+			if (progress && event.status === "started") {
+				progress.textContent = "Waiting for Fitbit authorization...";
+			}
+			return;
+		}
+		if (event.status === "started") {
+			return;
+		}
+
+		finished.add(event.metric);
+		if (progress) {
+			progress.textContent = `Refreshing... ${finished.size}/${metrics.length}`;
+		}
+		if (event.status === "failed") {
+			showToast(`Failed to refresh ${event.metric.replace("_", " ")}`);
+			return;
+		}
+		reloadCards(event.metric);
+	});
+
+	source.addEventListener("complete", (e) => {
+		source.close();
+		const event = JSON.parse(e.data);
+		showToast(event.status === "failed" ? "Refresh failed: " + event.error : "Data updated");
+		htmx.ajax("GET", badge.dataset.status, { target: "#sync-badge", swap: "outerHTML" });
+	});
+
+	// The stream ends with the request, e.g. when the server restarts
+	source.onerror = () => source.close();
+}
+
+// reloadCards swaps in fresh copies of the cards drawn from a synced metric,
+// for the date range in the address bar. Cards drawn from several metrics list
+// them all in data-sync-metric.
+function reloadCards(metric) {
+	document.querySelectorAll(`[data-sync-metric~="${metric}"]`).forEach((card) => {
+		const url = card.dataset.src + window.location.search;
+		htmx.ajax("GET", url, { target: "#" + card.id, swap: "outerHTML" });
+	});
+}
+
+htmx.onLoad((elt) => {
+	const badge = elt.id === "sync-badge" ? elt : elt.querySelector("#sync-badge");
+	if (badge) {
+		followSync(badge);
+	}
+});
@@ -0,0 +1,204 @@
+// Package static embeds the stylesheets and scripts of the dashboard so the binary
+// runs from any directory and without internet access.
+package static
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Prefix is the URL path the assets are served under
+const Prefix = "/static/"
+
+// Vendored third-party scripts, fetched with `./launch.sh --vendor` and committed so
+// the dashboard works without internet access. Until then the pages load them from
+// their CDNs.
+const (
+	HtmxJS       = "js/vendor/htmx.min.js"
+	EchartsJS    = "js/vendor/echarts/echarts.min.js"
+	EchartsTheme = "js/vendor/echarts/themes/macarons.js"
+)
+
+// Vendored lists the third-party scripts the pages load from the binary once committed
+var Vendored = []string{HtmxJS, EchartsJS, EchartsTheme}
+
+//go:embed css js
+var files embed.FS
+
+// asset is one embedded file with its lazily built compressed variants
+type asset struct {
+	name        string // path below Prefix, e.g. css/styles.css
+	hashed      string // name with the content hash, e.g. css/styles.1a2b3c4d.css
+	etag        string
+	contentType string
+	data        []byte
+
+	compressOnce sync.Once
+	gzip         []byte
+	brotli       []byte
+}
+
+var (
+	byName = map[string]*asset{} // plain names
+	byPath = map[string]*asset{} // plain and hashed names
+)
+
+func init() {
+	err := fs.WalkDir(files, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:12]
+		ext := path.Ext(name)
+		contentType := mime.TypeByExtension(ext)
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+
+		a := &asset{
+			name:        name,
+			hashed:      strings.TrimSuffix(name, ext) + "." + hash + ext,
+			etag:        `"` + hash + `"`,
+			contentType: contentType,
+			data:        data,
+		}
+		byName[a.name] = a
+		byPath[a.name] = a
+		byPath[a.hashed] = a
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Failed to index embedded assets: %v", err)
+	}
+}
+
+// Has reports whether an asset is embedded. Vendored scripts are missing until they are fetched.
+func Has(name string) bool {
+	_, ok := byName[name]
+	return ok
+}
+
+// Missing returns the vendored scripts that were not embedded
+func Missing() []string {
+	var missing []string
+	for _, name := range Vendored {
+		if _, ok := byName[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Path returns the content-hashed URL of an asset, which may be cached forever
+func Path(name string) string {
+	a, ok := byName[name]
+	if !ok {
+		return Prefix + name
+	}
+	return Prefix + a.hashed
+}
+
+// Dir returns the unhashed URL of an asset directory, for libraries that append file names themselves
+func Dir(name string) string {
+	return Prefix + strings.TrimSuffix(name, "/") + "/"
+}
+
+// compress builds the gzip and brotli variants once, on the first request for the asset
+func (a *asset) compress() {
+	a.compressOnce.Do(func() {
+		if !compressible(a.contentType) {
+			return
+		}
+
+		var gz bytes.Buffer
+		gw, _ := gzip.NewWriterLevel(&gz, gzip.BestCompression)
+		gw.Write(a.data)
+		gw.Close()
+		if gz.Len() < len(a.data) {
+			a.gzip = gz.Bytes()
+		}
+
+		var br bytes.Buffer
+		bw := brotli.NewWriterLevel(&br, brotli.BestCompression)
+		bw.Write(a.data)
+		bw.Close()
+		if br.Len() < len(a.data) {
+			a.brotli = br.Bytes()
+		}
+	})
+}
+
+func compressible(contentType string) bool {
+	return strings.HasPrefix(contentType, "text/") ||
+		strings.Contains(contentType, "javascript") ||
+		strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "svg")
+}
+
+// accepts reports whether the Accept-Encoding header allows encoding
+func accepts(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.TrimSpace(name) == encoding && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler serves the embedded assets below Prefix. Hashed URLs are immutable and cached
+// for a year, plain URLs are revalidated with their ETag.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, Prefix)
+		a, ok := byPath[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		h := w.Header()
+		if name == a.hashed {
+			h.Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			h.Set("Cache-Control", "no-cache")
+		}
+		h.Set("ETag", a.etag)
+		h.Set("Content-Type", a.contentType)
+		h.Set("Vary", "Accept-Encoding")
+
+		a.compress()
+		body := a.data
+		acceptEncoding := r.Header.Get("Accept-Encoding")
+		switch {
+		case a.brotli != nil && accepts(acceptEncoding, "br"):
+			h.Set("Content-Encoding", "br")
+			body = a.brotli
+		case a.gzip != nil && accepts(acceptEncoding, "gzip"):
+			h.Set("Content-Encoding", "gzip")
+			body = a.gzip
+		}
+
+		// ServeContent answers If-None-Match from the ETag header and handles range requests
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
+	})
+}
@@ -0,0 +1,38 @@
+package static
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestVendoredEmbedded(t *testing.T) {
+	missing := Missing()
+	if len(missing) == len(Vendored) {
+		t.Skip("htmx and echarts are not vendored, the pages load them from their CDNs; run ./launch.sh --vendor and commit static/js/vendor")
+	}
+	// The pages fall back to the CDNs per library, a partial set mixes versions
+	for _, name := range Vendored {
+		info, err := fs.Stat(files, name)
+		if err != nil {
+			t.Errorf("%s is not embedded: %v", name, err)
+			continue
+		}
+		if info.Size() == 0 {
+			t.Errorf("%s is empty", name)
+		}
+		if path := Path(name); path == Prefix+name || !strings.HasPrefix(path, Prefix) {
+			t.Errorf("%s is served at %s, want a content-hashed URL", name, path)
+		}
+	}
+}
+
+func TestPathHashesEmbeddedAssets(t *testing.T) {
+	path := Path("js/dashboard.js")
+	if path == Prefix+"js/dashboard.js" || !strings.HasSuffix(path, ".js") {
+		t.Errorf("dashboard.js is served at %s, want a content-hashed URL", path)
+	}
+	if !Has("js/dashboard.js") || Has("js/none.js") {
+		t.Error("Has does not match the embedded files")
+	}
+}
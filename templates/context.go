@@ -0,0 +1,64 @@
+package templates
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type userNavKey struct{}
+
+// UserNav holds the linked Fitbit accounts shown in the navigation bar
+type UserNav struct {
+	Current string
+	Users   []string
+}
+
+// WithUserNav stores the user switcher state in ctx for the layout to render
+func WithUserNav(ctx context.Context, nav UserNav) context.Context {
+	return context.WithValue(ctx, userNavKey{}, nav)
+}
+
+func userNav(ctx context.Context) UserNav {
+	nav, _ := ctx.Value(userNavKey{}).(UserNav)
+	return nav
+}
+
+// UserURL returns path below the URL prefix of user
+func UserURL(user, path string) string {
+	return "/u/" + user + path
+}
+
+// userURL returns path below the URL prefix of the current user
+func userURL(ctx context.Context, path string) string {
+	return UserURL(userNav(ctx).Current, path)
+}
+
+type loginKey struct{}
+
+// WithLogin stores the name of the logged in dashboard user in ctx
+func WithLogin(ctx context.Context, username string) context.Context {
+	return context.WithValue(ctx, loginKey{}, username)
+}
+
+func loginName(ctx context.Context) string {
+	username, _ := ctx.Value(loginKey{}).(string)
+	return username
+}
+
+type csrfKey struct{}
+
+// WithCSRFToken stores the CSRF token of the request in ctx
+func WithCSRFToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, csrfKey{}, token)
+}
+
+func csrfToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfKey{}).(string)
+	return token
+}
+
+// csrfHeaders returns the hx-headers value that makes htmx send the CSRF token
+func csrfHeaders(ctx context.Context) string {
+	headers, _ := json.Marshal(map[string]string{"X-CSRF-Token": csrfToken(ctx)})
+	return string(headers)
+}
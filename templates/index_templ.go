@@ -8,9 +8,9 @@ package templates
 import "github.com/a-h/templ"
 import templruntime "github.com/a-h/templ/runtime"
 
-import "html/template"
+import "time"
 
-func Index(stepsChart, elevationChart, calorieChart, heartRateChart, restingRateChart template.HTML) templ.Component {
+func Index(form RangeForm, syncedAt time.Time, syncing bool, metrics []string, rings []GoalRing, records []PersonalRecord, anomalies AnomalyList, comparison *ComparisonSummary, cards []ChartCard) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -43,15 +43,55 @@ func Index(stepsChart, elevationChart, calorieChart, heartRateChart, restingRate
 				}()
 			}
 			ctx = templ.InitializeContext(ctx)
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"toast\" class=\"toast\"></div><div class=\"dashboard-container\">")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 1, "<div id=\"toast\" class=\"toast\"></div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = Charts(stepsChart, elevationChart, calorieChart, heartRateChart, restingRateChart).Render(ctx, templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = SyncBadge(syncedAt, syncing, metrics).Render(ctx, templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "</div><div class=\"dashboard-controls\"><form id=\"days-form\" hx-post=\"/update-days\" hx-target=\".dashboard-charts\" hx-swap=\"outerHTML\" hx-on::before-request=\"showToast('Updating charts...')\" hx-on::after-request=\"showToast('Charts updated successfully!')\"><label for=\"days_back\">Days to Show:</label> <select id=\"days_back\" name=\"days_back\"><option value=\"7\">7</option> <option value=\"14\">14</option> <option value=\"21\">21</option> <option value=\"28\" selected>28</option></select> <button type=\"submit\">Update</button></form></div><script>\n\t\tfunction showToast(message) {\n\t\t\tconsole.log(\"triggered\")\n\t\t\tconst toast = htmx.find(\"#toast\");\n\t\t\ttoast.textContent = message;\n\t\t\ttoast.classList.add(\"show\");\n\t\t\tsetTimeout(() => {\n\t\t\t\ttoast.classList.remove(\"show\");\n\t\t\t}, 3000);\n\t\t}\n\t\t</script>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, " ")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = GoalRings(rings).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, " ")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = NewRecords(records).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, " ")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = Anomalies(anomalies).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, " <div class=\"dashboard-container\">")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = Charts(comparison, cards).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</div><div class=\"dashboard-controls\">")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = RangePicker(form, false).Render(ctx, templ_7745c5c3_Buffer)
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "</div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}